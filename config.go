@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+// Config is the configuration read from the environment.
+type Config struct {
+	// Port is the port to listen on, PORT. It defaults to 443 with TLS and
+	// 80 without.
+	Port int
+
+	// LokaliseAPIToken is the read-only Lokalise API token,
+	// LOKALISE_READ_ONLY_API_TOKEN. It is required.
+	LokaliseAPIToken string
+
+	// WebhookSecrets are the comma-separated secrets Lokalise may send with
+	// webhooks, LOKALISE_WEBHOOK_SECRET, the current one first. At least one
+	// is required. Adding the new secret before the old one lets both be
+	// accepted while the secret is rotated.
+	WebhookSecrets []string
+
+	// AdminToken is the bearer token of the admin endpoints, such as replay,
+	// ADMIN_TOKEN. They are disabled when it is empty.
+	AdminToken string
+
+	// LogLevel is the minimum level of the lines logged, LOG_LEVEL. It
+	// defaults to trace.
+	LogLevel string
+
+	// Env is the environment the listener runs in, e.g. "staging", APP_ENV.
+	// It is added to every log line if set.
+	Env string
+
+	// TLSCertificatePath and TLSPrivateKeyPath are the PEM files of the TLS
+	// certificate, TLS_CERTIFICATE_PATH and TLS_PRIVATE_KEY_PATH. Plain HTTP
+	// is served when neither is set.
+	TLSCertificatePath string
+	TLSPrivateKeyPath  string
+
+	// ProjectAllowlist and ProjectDenylist are the comma-separated IDs of the
+	// projects whose events are processed, LOKALISE_PROJECT_ALLOWLIST, and
+	// ignored, LOKALISE_PROJECT_DENYLIST. All projects are processed when
+	// both are empty.
+	ProjectAllowlist []string
+	ProjectDenylist  []string
+
+	// DryRun makes the listener log the actions it would take instead of
+	// taking them, DRY_RUN. It defaults to false.
+	DryRun bool
+
+	// CaptureDir is the directory where the recent webhook payloads are
+	// saved, CAPTURE_DIR. None are saved when it is empty, the default.
+	// CaptureMaxCount, CAPTURE_MAX_COUNT, and CaptureMaxBytes,
+	// CAPTURE_MAX_BYTES, bound the payloads kept. They default to 1000
+	// payloads and 100MB.
+	CaptureDir      string
+	CaptureMaxCount int
+	CaptureMaxBytes int64
+
+	// SlackWebhookURL is the Slack incoming webhook notified of events,
+	// SLACK_WEBHOOK_URL, if any.
+	SlackWebhookURL string
+}
+
+// LoadConfig reads the configuration from the environment. All the missing
+// and invalid values are reported together in the error.
+func LoadConfig() (*Config, error) {
+	config := &Config{
+		LokaliseAPIToken:   os.Getenv("LOKALISE_READ_ONLY_API_TOKEN"),
+		WebhookSecrets:     utils.SplitList(os.Getenv("LOKALISE_WEBHOOK_SECRET")),
+		AdminToken:         os.Getenv("ADMIN_TOKEN"),
+		LogLevel:           os.Getenv("LOG_LEVEL"),
+		Env:                os.Getenv("APP_ENV"),
+		TLSCertificatePath: os.Getenv("TLS_CERTIFICATE_PATH"),
+		TLSPrivateKeyPath:  os.Getenv("TLS_PRIVATE_KEY_PATH"),
+		SlackWebhookURL:    os.Getenv("SLACK_WEBHOOK_URL"),
+		ProjectAllowlist:   utils.SplitList(os.Getenv("LOKALISE_PROJECT_ALLOWLIST")),
+		ProjectDenylist:    utils.SplitList(os.Getenv("LOKALISE_PROJECT_DENYLIST")),
+		CaptureDir:         os.Getenv("CAPTURE_DIR"),
+		CaptureMaxCount:    1000,
+		CaptureMaxBytes:    100 << 20,
+	}
+
+	var errs []error
+	if port := os.Getenv("PORT"); len(port) > 0 {
+		var err error
+		if config.Port, err = strconv.Atoi(port); err != nil || config.Port < 1 || config.Port > 65535 {
+			errs = append(errs, fmt.Errorf("PORT %q is not a port number", port))
+		}
+	}
+
+	if dryRun := os.Getenv("DRY_RUN"); len(dryRun) > 0 {
+		var err error
+		if config.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			errs = append(errs, fmt.Errorf("DRY_RUN %q is not a boolean", dryRun))
+		}
+	}
+
+	if maxCount := os.Getenv("CAPTURE_MAX_COUNT"); len(maxCount) > 0 {
+		var err error
+		if config.CaptureMaxCount, err = strconv.Atoi(maxCount); err != nil {
+			errs = append(errs, fmt.Errorf("CAPTURE_MAX_COUNT %q is not a number", maxCount))
+		}
+	}
+	if maxBytes := os.Getenv("CAPTURE_MAX_BYTES"); len(maxBytes) > 0 {
+		var err error
+		if config.CaptureMaxBytes, err = strconv.ParseInt(maxBytes, 10, 64); err != nil {
+			errs = append(errs, fmt.Errorf("CAPTURE_MAX_BYTES %q is not a number", maxBytes))
+		}
+	}
+
+	if len(config.LokaliseAPIToken) == 0 {
+		errs = append(errs, errors.New("LOKALISE_READ_ONLY_API_TOKEN is not set"))
+	}
+	if len(config.WebhookSecrets) == 0 {
+		errs = append(errs, errors.New("LOKALISE_WEBHOOK_SECRET is not set"))
+	}
+
+	if len(config.LogLevel) == 0 {
+		config.LogLevel = "trace"
+	} else if logger, err := logging.ParseLevel(config.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q is not a log level", config.LogLevel))
+	} else {
+		config.LogLevel = logger.Level
+	}
+
+	if (len(config.TLSCertificatePath) == 0) != (len(config.TLSPrivateKeyPath) == 0) {
+		errs = append(errs, errors.New("TLS_CERTIFICATE_PATH and TLS_PRIVATE_KEY_PATH must be set together"))
+	}
+
+	if len(config.SlackWebhookURL) > 0 {
+		if u, err := url.Parse(config.SlackWebhookURL); err != nil || u.Scheme != "https" {
+			errs = append(errs, errors.New("SLACK_WEBHOOK_URL is not an https URL"))
+		}
+	}
+
+	if len(errs) > 0 {
+		problems := make([]string, len(errs))
+		for i, err := range errs {
+			problems[i] = err.Error()
+		}
+		return config, fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return config, nil
+}
+
+// LogArgs returns the configuration as log args, with the secrets redacted.
+func (config *Config) LogArgs() logging.Args {
+	return logging.Args{
+		"port":                 logging.Int(config.Port),
+		"lokalise_api_token":   redactedIfSet(config.LokaliseAPIToken),
+		"webhook_secrets":      logging.Int(len(config.WebhookSecrets)),
+		"admin_token":          redactedIfSet(config.AdminToken),
+		"log_level":            config.LogLevel,
+		"env":                  config.Env,
+		"tls_certificate_path": config.TLSCertificatePath,
+		"tls_private_key_path": config.TLSPrivateKeyPath,
+		"slack_webhook_url":    redactedIfSet(config.SlackWebhookURL),
+		"project_allowlist":    strings.Join(config.ProjectAllowlist, ","),
+		"project_denylist":     strings.Join(config.ProjectDenylist, ","),
+		"dry_run":              logging.Bool(config.DryRun),
+		"capture_dir":          config.CaptureDir,
+		"capture_max_count":    logging.Int(config.CaptureMaxCount),
+		"capture_max_bytes":    logging.Int64(config.CaptureMaxBytes),
+	}
+}
+
+// redactedIfSet returns logging.Redacted in place of a secret, so that the
+// logs still show whether it is set.
+func redactedIfSet(secret string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	return logging.Redacted
+}
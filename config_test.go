@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// configEnv is a valid environment, which the tests change.
+var configEnv = map[string]string{
+	"PORT":                         "",
+	"LOKALISE_READ_ONLY_API_TOKEN": "api-token-value",
+	"LOKALISE_WEBHOOK_SECRET":      "new-secret-value, old-secret-value",
+	"ADMIN_TOKEN":                  "admin-token-value",
+	"LOG_LEVEL":                    "",
+	"APP_ENV":                      "",
+	"TLS_CERTIFICATE_PATH":         "",
+	"TLS_PRIVATE_KEY_PATH":         "",
+	"SLACK_WEBHOOK_URL":            "https://hooks.slack.com/services/slack-path-value",
+	"LOKALISE_PROJECT_ALLOWLIST":   "",
+	"LOKALISE_PROJECT_DENYLIST":    "",
+	"DRY_RUN":                      "",
+	"CAPTURE_DIR":                  "",
+	"CAPTURE_MAX_COUNT":            "",
+	"CAPTURE_MAX_BYTES":            "",
+}
+
+func setConfigEnv(t *testing.T, overrides map[string]string) {
+	for key, value := range configEnv {
+		if override, ok := overrides[key]; ok {
+			value = override
+		}
+		t.Setenv(key, value)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		env      map[string]string
+		level    string
+		problems []string
+	}{
+		{
+			name:  "valid",
+			level: "trace",
+		},
+		{
+			name:  "mixed-case log level",
+			env:   map[string]string{"LOG_LEVEL": " Warn "},
+			level: "warn",
+		},
+		{
+			name: "missing token and secret",
+			env: map[string]string{
+				"LOKALISE_READ_ONLY_API_TOKEN": "",
+				"LOKALISE_WEBHOOK_SECRET":      " , ",
+			},
+			problems: []string{
+				"LOKALISE_READ_ONLY_API_TOKEN is not set",
+				"LOKALISE_WEBHOOK_SECRET is not set",
+			},
+		},
+		{
+			name: "bad port and dry run",
+			env: map[string]string{
+				"PORT":    "https",
+				"DRY_RUN": "maybe",
+			},
+			problems: []string{
+				`PORT "https" is not a port number`,
+				`DRY_RUN "maybe" is not a boolean`,
+			},
+		},
+		{
+			name:     "port out of range",
+			env:      map[string]string{"PORT": "70000"},
+			problems: []string{`PORT "70000" is not a port number`},
+		},
+		{
+			name:     "half-set TLS pair",
+			env:      map[string]string{"TLS_CERTIFICATE_PATH": "/etc/tls/cert.pem"},
+			problems: []string{"TLS_CERTIFICATE_PATH and TLS_PRIVATE_KEY_PATH must be set together"},
+		},
+		{
+			name: "every problem at once",
+			env: map[string]string{
+				"LOKALISE_READ_ONLY_API_TOKEN": "",
+				"TLS_PRIVATE_KEY_PATH":         "/etc/tls/key.pem",
+				"LOG_LEVEL":                    "loud",
+				"SLACK_WEBHOOK_URL":            "http://hooks.slack.com/services/x",
+				"CAPTURE_MAX_COUNT":            "many",
+			},
+			problems: []string{
+				`CAPTURE_MAX_COUNT "many" is not a number`,
+				"LOKALISE_READ_ONLY_API_TOKEN is not set",
+				`LOG_LEVEL "loud" is not a log level`,
+				"TLS_CERTIFICATE_PATH and TLS_PRIVATE_KEY_PATH must be set together",
+				"SLACK_WEBHOOK_URL is not an https URL",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setConfigEnv(t, test.env)
+
+			config, err := LoadConfig()
+
+			if len(test.problems) == 0 {
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"new-secret-value", "old-secret-value"}, config.WebhookSecrets)
+				assert.Equal(t, test.level, config.LogLevel)
+				// The level is one SetMinLevel knows.
+				assert.NoError(t, logging.SetMinLevel(config.LogLevel))
+				defer logging.SetMinLevel("trace")
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equal(t, "invalid configuration: "+strings.Join(test.problems, "; "), err.Error())
+			}
+		})
+	}
+}
+
+func TestConfigLogArgsRedactsSecrets(t *testing.T) {
+	setConfigEnv(t, nil)
+	config, err := LoadConfig()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	args := config.LogArgs()
+	for key, value := range args {
+		for _, secret := range []string{"api-token-value", "secret-value", "admin-token-value", "slack-path-value"} {
+			assert.NotContains(t, value, secret, key)
+		}
+	}
+	assert.Equal(t, logging.Redacted, args["lokalise_api_token"])
+	assert.Equal(t, logging.Redacted, args["admin_token"])
+	assert.Equal(t, logging.Redacted, args["slack_webhook_url"])
+	assert.Equal(t, "2", args["webhook_secrets"])
+
+	// Unset secrets are shown as such.
+	config.AdminToken = ""
+	assert.Equal(t, "", config.LogArgs()["admin_token"])
+}
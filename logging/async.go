@@ -0,0 +1,199 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// AsyncPolicy determines what happens to a log line when the async buffer
+// is full.
+type AsyncPolicy int
+
+const (
+	// AsyncBlock makes the logging call wait until there is room in the
+	// buffer. No lines are lost, but a stalled output stalls the caller.
+	AsyncBlock AsyncPolicy = iota
+
+	// AsyncDrop discards the line and counts it in DroppedLines. The caller
+	// never waits, at the cost of losing lines under sustained load.
+	AsyncDrop
+)
+
+// asyncLine is a fully encoded log line waiting to be written. A line with a
+// non-nil flushed channel is a flush marker rather than output.
+type asyncLine struct {
+	level   string
+	buf     *bytes.Buffer
+	flushed chan struct{}
+}
+
+type asyncWriter struct {
+	lines  chan asyncLine
+	policy AsyncPolicy
+	done   chan struct{}
+}
+
+var (
+	// async is the active async writer, or nil in synchronous mode.
+	async      *asyncWriter
+	asyncMutex sync.RWMutex
+
+	droppedLines uint64
+)
+
+// EnableAsync switches to asynchronous logging: log calls encode their line
+// and hand it to a background goroutine through a buffer of bufferSize lines,
+// and policy decides what happens when that buffer is full. Fatal logs are
+// always written synchronously, after everything queued before them. Call
+// Close before the program exits so queued lines aren't lost.
+func EnableAsync(bufferSize int, policy AsyncPolicy) {
+	Close()
+
+	writer := &asyncWriter{
+		lines:  make(chan asyncLine, bufferSize),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+	go writer.run()
+
+	asyncMutex.Lock()
+	async = writer
+	asyncMutex.Unlock()
+}
+
+// Flush blocks until every line logged before the call has been written,
+// including the lines queued in async mode, and then commits the outputs
+// that are files to stable storage with Sync, so callers can
+// "defer logging.Flush()" before exiting. Outputs that aren't files need no
+// flushing. The errors of failed syncs are returned.
+func Flush() error {
+	asyncMutex.RLock()
+	if async != nil {
+		flushed := make(chan struct{})
+		async.lines <- asyncLine{flushed: flushed}
+		<-flushed
+	}
+	asyncMutex.RUnlock()
+
+	return syncOutputs()
+}
+
+// syncOutputs calls Sync on each output that is a file, and Flush on each
+// output that queues lines itself. Terminals and pipes can't be synced,
+// which isn't an error.
+func syncOutputs() error {
+	outputMutex.Lock()
+	unique := make(map[io.Writer]bool, 2)
+	for _, w := range outputs {
+		unique[w] = true
+	}
+	outputMutex.Unlock()
+
+	var errs []error
+	for w := range unique {
+		if err := syncOutput(w); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncOutput is syncOutputs for a single output.
+func syncOutput(w io.Writer) error {
+	switch w := w.(type) {
+	case *os.File:
+		if err := w.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTSUP) {
+			return fmt.Errorf("syncing log output %s: %w", w.Name(), err)
+		}
+	case interface{ Flush() error }:
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("flushing log output: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close writes any queued lines and returns to synchronous logging.
+func Close() {
+	asyncMutex.Lock()
+	writer := async
+	async = nil
+	asyncMutex.Unlock()
+
+	if writer == nil {
+		return
+	}
+
+	close(writer.lines)
+	<-writer.done
+}
+
+// DroppedLines returns the number of lines discarded because the async
+// buffer was full under the AsyncDrop policy.
+func DroppedLines() uint64 {
+	return atomic.LoadUint64(&droppedLines)
+}
+
+func (writer *asyncWriter) run() {
+	defer close(writer.done)
+
+	for line := range writer.lines {
+		if line.flushed != nil {
+			close(line.flushed)
+			continue
+		}
+		writeSync(line.level, line.buf)
+	}
+}
+
+// writeLine writes an encoded line for level, queueing it in async mode. It
+// takes ownership of buf and returns it to the pool once written.
+func writeLine(level string, buf *bytes.Buffer) {
+	asyncMutex.RLock()
+	defer asyncMutex.RUnlock()
+
+	if async == nil {
+		writeSync(level, buf)
+		return
+	}
+
+	line := asyncLine{level: level, buf: buf}
+	if async.policy == AsyncBlock {
+		async.lines <- line
+		return
+	}
+
+	select {
+	case async.lines <- line:
+	default:
+		atomic.AddUint64(&droppedLines, 1)
+		putBuffer(buf)
+	}
+}
+
+// writeInternal writes lines logged by the package itself, bypassing the
+// async queue. If an output is being written, which may be by the calling
+// goroutine, the line is written in the background once it is done instead
+// of waiting, which could deadlock.
+func writeInternal(level string, buf *bytes.Buffer) {
+	if !outputMutex.TryLock() {
+		go writeSync(level, buf)
+		return
+	}
+	outputFor(level).Write(buf.Bytes())
+	outputMutex.Unlock()
+	putBuffer(buf)
+}
+
+func writeSync(level string, buf *bytes.Buffer) {
+	outputMutex.Lock()
+	outputFor(level).Write(buf.Bytes())
+	outputMutex.Unlock()
+	putBuffer(buf)
+}
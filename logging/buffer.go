@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxPooledBufferSize keeps the occasional huge log line from pinning a large
+// buffer in the pool forever.
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool. The caller must not use it afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// jsonEncoder is a buffer paired with an encoder that writes to it, so JSON
+// doesn't need to set up a new encoder per call.
+type jsonEncoder struct {
+	buf     bytes.Buffer
+	encoder *json.Encoder
+}
+
+var jsonEncoderPool = sync.Pool{
+	New: func() interface{} {
+		pair := &jsonEncoder{}
+		pair.encoder = json.NewEncoder(&pair.buf)
+		pair.encoder.SetEscapeHTML(false)
+		return pair
+	},
+}
+
+// getJSONEncoder returns an encoder with an empty buffer from the pool.
+func getJSONEncoder() *jsonEncoder {
+	pair := jsonEncoderPool.Get().(*jsonEncoder)
+	pair.buf.Reset()
+	return pair
+}
+
+// putJSONEncoder returns pair to the pool. The caller must not use it
+// afterwards.
+func putJSONEncoder(pair *jsonEncoder) {
+	if pair.buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	jsonEncoderPool.Put(pair)
+}
+
+// fixedField is a key-value pair written by encodeFixedFields.
+type fixedField struct {
+	key   string
+	value string
+}
+
+// encodeFixedFields writes fields as a single line JSON object, in the order
+// given, escaping strings like encodeJSONString.
+func encodeFixedFields(buf *bytes.Buffer, fields []fixedField) {
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodeJSONString(buf, field.key)
+		buf.WriteByte(':')
+		encodeJSONString(buf, field.value)
+	}
+	buf.WriteString("}\n")
+}
+
+const hexDigits = "0123456789abcdef"
+
+// encodeJSONString writes s as a quoted JSON string, using the same escapes
+// as encoding/json with HTML escaping disabled. Invalid UTF-8 is replaced
+// with the \ufffd escape, as encoding/json did before Go 1.25, rather than
+// with the raw U+FFFD that newer versions write, so that the output doesn't
+// depend on the Go version.
+func encodeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+
+			buf.WriteString(s[start:i])
+			switch b {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case '\b':
+				buf.WriteString(`\b`)
+			case '\f':
+				buf.WriteString(`\f`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[b>>4])
+				buf.WriteByte(hexDigits[b&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+
+		// U+2028 and U+2029 are valid JSON but break JavaScript parsers,
+		// so encoding/json escapes them too.
+		if r == '\u2028' || r == '\u2029' {
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\u202`)
+			buf.WriteByte(hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+
+		i += size
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
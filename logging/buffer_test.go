@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeFixedFields(t *testing.T) {
+	values := []string{
+		"",
+		"plain",
+		`quotes " and \ backslashes`,
+		"<html> & friends",
+		"control \b\f\n\r\t\x00\x1f\x7f",
+		"unicode \u00e9 \u65e5\u672c \u2028 \u2029 \ufffd",
+	}
+
+	for _, value := range values {
+		fields := []fixedField{{"a", value}, {"b", "second"}}
+
+		var expected bytes.Buffer
+		encoder := json.NewEncoder(&expected)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(map[string]string{"a": value, "b": "second"})
+
+		var actual bytes.Buffer
+		encodeFixedFields(&actual, fields)
+		assert.Equal(t, expected.String(), actual.String())
+	}
+}
+
+func TestEncodeJSONStringInvalidUTF8(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		{"invalid \xff utf-8", `"invalid \ufffd utf-8"`},
+		{"\xff\xfe", `"\ufffd\ufffd"`},
+		{"truncated \xe6\x97", `"truncated \ufffd\ufffd"`},
+		{"\xffwith \"escapes\"\n", `"\ufffdwith \"escapes\"\n"`},
+	} {
+		var fixed bytes.Buffer
+		encodeFixedFields(&fixed, []fixedField{{"a", test.value}})
+		assert.Equal(t, `{"a":`+test.expected+"}\n", fixed.String(), test.value)
+
+		var formatted bytes.Buffer
+		assert.NoError(t, JSONFormatter{}.Format(&formatted, Fields{"a": test.value}))
+		assert.Equal(t, fixed.String(), formatted.String(), test.value)
+
+		// Depending on the Go version, encoding/json writes either the same
+		// escape or the raw U+FFFD, which decodes the same.
+		marshaled, err := json.Marshal(test.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, test.expected, strings.ReplaceAll(string(marshaled), "\ufffd", `\ufffd`), test.value)
+		}
+	}
+}
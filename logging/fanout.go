@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// internalErrors receives reports of problems the logger can't log, such as
+// an output failing.
+var internalErrors io.Writer = os.Stderr
+
+// AddOutput writes all subsequent log lines, regardless of level, to w in
+// addition to the outputs they are already written to, e.g. to log to
+// stdout and a file at once. Unlike with io.MultiWriter, an output failing
+// doesn't stop lines being written to the others. The first failure of each
+// added output is reported on stderr.
+func AddOutput(w io.Writer) {
+	target := &fanOutTarget{w: w}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	for _, level := range levels {
+		var targets []*fanOutTarget
+		if existing, ok := outputs[level].(fanOutWriter); ok {
+			targets = append(targets, existing...)
+		} else {
+			targets = append(targets, &fanOutTarget{w: outputs[level]})
+		}
+		outputs[level] = fanOutWriter(append(targets, target))
+		terminalOutputs[level] = false
+	}
+}
+
+// fanOutTarget is one of the outputs of a fanOutWriter. Targets are shared
+// between levels, so that each failing output is reported once.
+type fanOutTarget struct {
+	w        io.Writer
+	reported int32
+}
+
+// fanOutWriter writes each line to all of its targets. Its slice is never
+// modified once it is an output.
+type fanOutWriter []*fanOutTarget
+
+// Write implements io.Writer. It only fails if every target fails.
+func (targets fanOutWriter) Write(p []byte) (int, error) {
+	var errs []error
+	for _, target := range targets {
+		if _, err := target.w.Write(p); err != nil {
+			errs = append(errs, err)
+			if atomic.CompareAndSwapInt32(&target.reported, 0, 1) {
+				fmt.Fprintf(internalErrors, "logging: writing to log output %T failed: %v\n", target.w, err)
+			}
+		}
+	}
+	if len(errs) == len(targets) {
+		return 0, errors.Join(errs...)
+	}
+	return len(p), nil
+}
+
+// Flush syncs or flushes each target that supports it, as Flush does for
+// outputs.
+func (targets fanOutWriter) Flush() error {
+	var errs []error
+	for _, target := range targets {
+		if err := syncOutput(target.w); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
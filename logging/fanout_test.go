@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAddOutput(t *testing.T) {
+	var first, second, reports bytes.Buffer
+	SetOutput(&first)
+	defer resetOutput()
+	internalErrors = &reports
+	defer func() { internalErrors = os.Stderr }()
+
+	AddOutput(failingWriter{})
+	AddOutput(&second)
+	Info().Log("to both")
+	Error().Log("to both again")
+
+	assert.Equal(t, first.String(), second.String())
+	assert.Equal(t, 2, strings.Count(first.String(), "\n"))
+	assert.Contains(t, first.String(), `"msg":"to both again"`)
+	assert.Equal(t, 1, strings.Count(reports.String(), "\n"))
+	assert.Contains(t, reports.String(), "disk full")
+}
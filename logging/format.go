@@ -0,0 +1,368 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formatter renders the fields of a log line. Format appends exactly one
+// line, including the trailing newline, to buf.
+type Formatter interface {
+	Format(buf *bytes.Buffer, fullArgs Fields) error
+}
+
+// SetFormatter changes how log lines are rendered. The default is
+// JSONFormatter; a nil formatter restores it.
+func SetFormatter(formatter Formatter) {
+	if formatter == nil {
+		formatter = JSONFormatter{}
+	}
+
+	updateOptions(func(opts *options) {
+		opts.formatter = formatter
+	})
+}
+
+// colorFormatter is implemented by formatters that can colorize their
+// output. formatColor is used instead of Format when color is enabled.
+type colorFormatter interface {
+	formatColor(buf *bytes.Buffer, fullArgs Fields) error
+}
+
+// reservedFieldNames are the keys that SetFieldNames can rename.
+var reservedFieldNames = []string{"msg", "msgTemplate", "time", "level", "file", "func", "line", "process", "error"}
+
+// SetFieldNames renames reserved keys in the lines written by JSONFormatter,
+// ConsoleFormatter and LogfmtFormatter, e.g. {"msg": "message"} to match an
+// ingestion schema. The reserved keys are msg, msgTemplate, time, level,
+// file, func, line, process and error; keys missing from names keep their
+// default names. Names replace any earlier renaming, and an error is returned
+// if a key isn't reserved or two keys would be written with the same name.
+// Custom formatters receive the default names.
+func SetFieldNames(names map[string]string) error {
+	for key := range names {
+		if !isReservedFieldName(key) {
+			return fmt.Errorf("logging: %q is not a reserved field", key)
+		}
+	}
+
+	fieldNames := make(map[string]string, len(names))
+	used := map[string]string{"host": "host", "pid": "pid"}
+	for _, key := range reservedFieldNames {
+		name := key
+		if renamed, ok := names[key]; ok {
+			name = renamed
+			fieldNames[key] = renamed
+		}
+		if name == "" {
+			return fmt.Errorf("logging: empty field name for %q", key)
+		}
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("logging: fields %q and %q are both named %q", other, key, name)
+		}
+		used[name] = key
+	}
+
+	updateOptions(func(opts *options) {
+		opts.fieldNames = fieldNames
+	})
+	return nil
+}
+
+func isReservedFieldName(key string) bool {
+	for _, reserved := range reservedFieldNames {
+		if key == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldName returns the name that key is written with.
+func (opts *options) fieldName(key string) string {
+	if name, ok := opts.fieldNames[key]; ok {
+		return name
+	}
+	return key
+}
+
+// ColorMode determines whether formatters that support color use it.
+type ColorMode int
+
+const (
+	// ColorAuto uses color only when the output is a terminal. This is the
+	// default.
+	ColorAuto ColorMode = iota
+
+	// ColorAlways always uses color.
+	ColorAlways
+
+	// ColorNever never uses color.
+	ColorNever
+)
+
+// levelColors holds the ANSI SGR color code of each level that is colorized.
+var levelColors = map[string]string{
+	"trace": "90",
+	"debug": "90",
+	"warn":  "33",
+	"error": "31",
+	"fatal": "31",
+}
+
+// SetColor sets whether formatters that support color, such as
+// ConsoleFormatter, use it. JSONFormatter and LogfmtFormatter never do.
+func SetColor(mode ColorMode) {
+	updateOptions(func(opts *options) {
+		opts.color = mode
+	})
+}
+
+// useColor reports whether lines of the given level should be colorized.
+func (opts *options) useColor(level string) bool {
+	switch opts.color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if terminal, ok := terminalOutputs[level]; ok {
+		return terminal
+	}
+	return terminalOutputs["info"]
+}
+
+// isTerminal reports whether w is a file connected to a terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// JSONFormatter renders each line as a single JSON object, as described in
+// the package documentation.
+type JSONFormatter struct{}
+
+// Format implements Formatter.
+func (JSONFormatter) Format(buf *bytes.Buffer, fullArgs Fields) error {
+	var encoder *json.Encoder
+	opts := loadOptions()
+
+	buf.WriteByte('{')
+	for i, key := range orderedKeys(fullArgs) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodeJSONString(buf, opts.fieldName(key))
+		buf.WriteByte(':')
+
+		if s, ok := fullArgs[key].(string); ok {
+			encodeJSONString(buf, s)
+			continue
+		}
+
+		if encoder == nil {
+			encoder = json.NewEncoder(buf)
+			encoder.SetEscapeHTML(false)
+		}
+		if err := encoder.Encode(fullArgs[key]); err != nil {
+			return err
+		}
+		// Encode terminates every value with a newline.
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// leadingKeys and callerKeys hold the fields that are written before and
+// after the args, in the order they are written.
+var (
+	leadingKeys = []string{"time", "level", "msg", "msgTemplate", "error", "errorChain"}
+	callerKeys  = []string{"caller", "file", "func", "line"}
+)
+
+// keyRank orders the groups of keys described in the package documentation.
+func keyRank(key string) int {
+	for i, leading := range leadingKeys {
+		if key == leading {
+			return i
+		}
+	}
+	if strings.HasPrefix(key, "arg_") {
+		return len(leadingKeys)
+	}
+	for i, caller := range callerKeys {
+		if key == caller {
+			return len(leadingKeys) + 1 + i
+		}
+	}
+	return len(leadingKeys) + 1 + len(callerKeys)
+}
+
+// orderedKeys returns the keys of fullArgs in the order documented in the
+// package documentation.
+func orderedKeys(fullArgs Fields) []string {
+	keys := make([]string, 0, len(fullArgs))
+	for key := range fullArgs {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		rankI, rankJ := keyRank(keys[i]), keyRank(keys[j])
+		if rankI != rankJ {
+			return rankI < rankJ
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// consoleOmittedFields are left out by ConsoleFormatter, either because they
+// start the line or because they are the same on every line.
+var consoleOmittedFields = map[string]bool{
+	"time":        true,
+	"level":       true,
+	"msg":         true,
+	"msgTemplate": true,
+	"process":     true,
+	"host":        true,
+	"pid":         true,
+}
+
+// ConsoleFormatter renders each line for humans as
+//
+//	<time> <LEVEL> <msg> key=value key=value...
+//
+// with the remaining fields sorted by key. The level is colorized according
+// to SetColor. It is meant for local development; the output is not meant to
+// be parsed.
+type ConsoleFormatter struct{}
+
+// Format implements Formatter.
+func (formatter ConsoleFormatter) Format(buf *bytes.Buffer, fullArgs Fields) error {
+	return formatter.format(buf, fullArgs, false)
+}
+
+func (formatter ConsoleFormatter) formatColor(buf *bytes.Buffer, fullArgs Fields) error {
+	return formatter.format(buf, fullArgs, true)
+}
+
+func (ConsoleFormatter) format(buf *bytes.Buffer, fullArgs Fields, color bool) error {
+	buf.WriteString(consoleValue(fullArgs["time"]))
+	buf.WriteRune(' ')
+	level := consoleValue(fullArgs["level"])
+	colorCode := levelColors[level]
+	if color && colorCode != "" {
+		buf.WriteString("\x1b[")
+		buf.WriteString(colorCode)
+		buf.WriteRune('m')
+	}
+	buf.WriteString(strings.ToUpper(level))
+	if color && colorCode != "" {
+		buf.WriteString("\x1b[0m")
+	}
+	buf.WriteRune(' ')
+	buf.WriteString(consoleValue(fullArgs["msg"]))
+
+	keys := make([]string, 0, len(fullArgs))
+	for key := range fullArgs {
+		if !consoleOmittedFields[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	opts := loadOptions()
+	for _, key := range keys {
+		value := consoleValue(fullArgs[key])
+		if strings.ContainsAny(value, " =\"\n") {
+			value = strconv.Quote(value)
+		}
+
+		buf.WriteRune(' ')
+		buf.WriteString(opts.fieldName(key))
+		buf.WriteRune('=')
+		buf.WriteString(value)
+	}
+	buf.WriteRune('\n')
+	return nil
+}
+
+// consoleValue renders a field value for ConsoleFormatter.
+func consoleValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return JSON(v)
+	}
+}
+
+// logfmtLeadingFields start every line written by LogfmtFormatter.
+var logfmtLeadingFields = []string{"time", "level", "msg"}
+
+// LogfmtFormatter renders each line as logfmt key=value pairs, starting with
+// time, level and msg followed by the remaining fields sorted by key. Values
+// that are empty or contain spaces, equals signs, quotes or control
+// characters are quoted and escaped.
+type LogfmtFormatter struct{}
+
+// Format implements Formatter.
+func (LogfmtFormatter) Format(buf *bytes.Buffer, fullArgs Fields) error {
+	keys := make([]string, 0, len(fullArgs))
+	for _, key := range logfmtLeadingFields {
+		if _, ok := fullArgs[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+
+	leading := len(keys)
+	for key := range fullArgs {
+		if key != "time" && key != "level" && key != "msg" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys[leading:])
+
+	opts := loadOptions()
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteRune(' ')
+		}
+		buf.WriteString(opts.fieldName(key))
+		buf.WriteRune('=')
+		buf.WriteString(logfmtValue(consoleValue(fullArgs[key])))
+	}
+	buf.WriteRune('\n')
+	return nil
+}
+
+// logfmtValue quotes value if it can't be written bare.
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
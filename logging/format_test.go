@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	err := ConsoleFormatter{}.Format(&buf, Fields{
+		"time":        "15:04:05",
+		"level":       "warn",
+		"msg":         "upload failed",
+		"msgTemplate": "upload failed",
+		"pid":         "1",
+		"arg_count":   3,
+		"arg_name":    "en us",
+		"error":       "boom",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "15:04:05 WARN upload failed arg_count=3 arg_name=\"en us\" error=boom\n", buf.String())
+}
+
+func TestSetFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+
+	SetFormatter(ConsoleFormatter{})
+	defer SetFormatter(nil)
+	SetCaller(false)
+	defer SetCaller(true)
+
+	Info().Log("started")
+	Info().LogArgs("project {{.id}}", Args{"id": "123"})
+
+	assert.Regexp(t, `^\S+ INFO started\n\S+ INFO project 123 arg_id=123\n$`, buf.String())
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	err := LogfmtFormatter{}.Format(&buf, Fields{
+		"time":         "2020-01-02T15:04:05Z",
+		"level":        "info",
+		"msg":          "hello world",
+		"arg_plain":    "bar",
+		"arg_equals":   "a=b",
+		"arg_quotes":   `say "hi"`,
+		"arg_newlines": "one\ntwo",
+		"arg_empty":    "",
+		"arg_number":   42,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `time=2020-01-02T15:04:05Z level=info msg="hello world" `+
+		`arg_empty="" arg_equals="a=b" arg_newlines="one\ntwo" arg_number=42 arg_plain=bar arg_quotes="say \"hi\""`+"\n",
+		buf.String())
+}
+
+func TestSetColor(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+
+	SetFormatter(ConsoleFormatter{})
+	defer SetFormatter(nil)
+
+	Warn().Log("auto")
+	SetColor(ColorAlways)
+	defer SetColor(ColorAuto)
+	Warn().Log("always")
+	Info().Log("uncolored level")
+
+	SetFormatter(JSONFormatter{})
+	Warn().Log("json")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Contains(t, lines[0], " WARN auto")
+	assert.NotContains(t, lines[0], "\x1b[")
+	assert.Contains(t, lines[1], " \x1b[33mWARN\x1b[0m always")
+	assert.Contains(t, lines[2], " INFO uncolored level")
+	assert.NotContains(t, lines[3], "\x1b[")
+}
+
+func TestJSONFormatterKeyOrder(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+
+	Warn().LogErrArgs("upload {{.b}}", errors.New("boom"), Args{"b": "2", "a": "1"})
+	Warn().Log("plain")
+
+	keyOrder := func(line string) []string {
+		var keys []string
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.Token()
+		for decoder.More() {
+			key, _ := decoder.Token()
+			keys = append(keys, key.(string))
+			var value interface{}
+			decoder.Decode(&value)
+		}
+		return keys
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, []string{
+		"time", "level", "msg", "msgTemplate", "error",
+		"arg_a", "arg_b",
+		"file", "func", "line",
+		"host", "pid", "process",
+	}, keyOrder(lines[0]))
+	assert.Equal(t, []string{
+		"time", "level", "msg", "msgTemplate",
+		"file", "func", "line",
+		"host", "pid", "process",
+	}, keyOrder(lines[1]))
+}
+
+func TestSetFieldNames(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+	defer SetFieldNames(nil)
+
+	assert.NoError(t, SetFieldNames(map[string]string{"msg": "message", "time": "timestamp", "error": "err"}))
+	Info().Log("plain")
+	Warn().LogErr("failed", errors.New("boom"))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for _, line := range lines {
+		entry := map[string]string{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.NotContains(t, entry, "msg")
+		assert.NotContains(t, entry, "time")
+		assert.NotEmpty(t, entry["timestamp"])
+		assert.NotEmpty(t, entry["level"])
+	}
+	assert.True(t, strings.HasPrefix(lines[0], `{"timestamp":`))
+	assert.Contains(t, lines[0], `"message":"plain"`)
+	assert.Contains(t, lines[1], `"message":"failed"`)
+	assert.Contains(t, lines[1], `"err":"boom"`)
+
+	buf.Reset()
+	SetFormatter(LogfmtFormatter{})
+	defer SetFormatter(nil)
+	Info().Log("logfmt")
+	assert.Contains(t, buf.String(), "message=logfmt")
+	SetFormatter(nil)
+
+	assert.Error(t, SetFieldNames(map[string]string{"msg": "text", "error": "text"}))
+	assert.Error(t, SetFieldNames(map[string]string{"msg": "level"}))
+	assert.Error(t, SetFieldNames(map[string]string{"func": "pid"}))
+	assert.Error(t, SetFieldNames(map[string]string{"msg": ""}))
+	assert.Error(t, SetFieldNames(map[string]string{"arg_project": "project"}))
+	assert.Equal(t, "message", loadOptions().fieldName("msg"))
+
+	assert.NoError(t, SetFieldNames(map[string]string{"msg": "text", "time": "msg"}))
+	assert.NoError(t, SetFieldNames(nil))
+	assert.Equal(t, "msg", loadOptions().fieldName("msg"))
+}
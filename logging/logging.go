@@ -1,5 +1,5 @@
 // Package logging provides a utility to write uniformly formatted logs.
-// Output structure:
+// Output structure (with the default JSONFormatter; see SetFormatter):
 // Each line of output is a json object starting with '{' and ending with '}'
 // Each line object has string values with the following structure:
 // {
@@ -12,26 +12,47 @@
 //   // Caller-supplied metadata
 //   "level": "info", // one of: ["trace", "debug", "info", "warn", "error", "fatal"]
 //   ["error": "error message"], // optional "error" field if present is a string error message.
+//   ["errorChain": ["outer: inner", "inner"]], // messages of each wrapped error, if the error wraps another.
 //
 //   // Context fields that get filled in automatically
-//   "time": "2006-01-02T15:04:05.123456789-07:00", // RFC3339Nano
+//   "time": "2006-01-02T15:04:05.123456789-07:00", // RFC3339Nano unless changed with SetTimeFormat/SetTimeZone
 //   "file": "main.go",
 //   "func": "ServeGrpc()",
 //   "line": "59", // note that this is a string.
 //   "process": "sms-auth-service", // executable name, no slash.
+//   "host": "listener-7d9f", // hostname, or the value given to SetHost.
+//   "pid": "4242", // process ID, also a string.
+//   ["stack": "main.main (main.go:59)\n..."], // call stack, for levels enabled with SetCaptureStack.
 // }
+//
+// Keys are written in a stable order: time, level, msg, msgTemplate, error and
+// errorChain first, then the args sorted by name, then file, func and line
+// (or caller, see SetNestedCaller), then any remaining fields sorted by name.
+//
+// All loggers are safe for concurrent use: each log line is written to its
+// output with a single locked write, so lines from different goroutines never
+// interleave. Writes happen synchronously unless EnableAsync is called.
 package logging
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
-	"text/template"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,10 +60,202 @@ import (
 // along with a log statement.
 type Args map[string]string
 
-// Logger contains the log level associated with a log.
+// Fields contains key-value pairs that should be displayed along with a log
+// statement. Unlike Args, the values keep their JSON types, so numbers, bools
+// and nested objects are not flattened into strings.
+type Fields map[string]interface{}
+
+// LazyField is a Fields value that is only computed if the line is written,
+// so expensive values, e.g. a JSON dump of a large struct, cost nothing when
+// their level is disabled. The line holds the string it returns.
+type LazyField func() string
+
+// resolveLazyFields returns fields with every LazyField replaced by its
+// value. Fields is returned as-is when it has none, and is never modified.
+func resolveLazyFields(fields Fields) Fields {
+	var resolved Fields
+	for k, v := range fields {
+		lazy, ok := v.(LazyField)
+		if !ok {
+			continue
+		}
+		if resolved == nil {
+			resolved = make(Fields, len(fields))
+			for k, v := range fields {
+				resolved[k] = v
+			}
+		}
+		resolved[k] = lazy()
+	}
+
+	if resolved == nil {
+		return fields
+	}
+	return resolved
+}
+
+// Logger contains the log level associated with a log. Level is one of
+// trace, debug, info, warn, error and fatal; loggers constructed with any
+// other level write their lines as info, after a one-time warning, so that
+// the "level" field can be relied on.
+//
+// The loggers returned by Trace, Debug, Info, Warn, Error and Fatal are
+// shared by the whole program, so modifying their Level or IsFatal is unsafe;
+// modify a Clone instead.
 type Logger struct {
 	Level   string
 	IsFatal bool
+
+	// fields are added to every line written by the logger.
+	fields Fields
+
+	// ctx carries request-scoped fields added with ContextWithFields.
+	ctx context.Context
+
+	// err is written with every line, unless the call passes its own.
+	err error
+
+	// callerSkip is the number of extra stack frames to skip when
+	// reporting the caller.
+	callerSkip int
+
+	// callerPC, if set, is reported as the caller instead of walking the
+	// stack. It is used by adapters that already know their caller.
+	callerPC uintptr
+
+	// discard drops every line without formatting it. See Discard.
+	discard bool
+
+	// internal marks loggers used by the package itself, possibly while an
+	// output is being written; see writeInternal.
+	internal bool
+
+	// rateLimited is the number of dropped lines reported in the
+	// "rateLimited" field. Lines that report it bypass the rate limit.
+	rateLimited uint64
+
+	// audit marks the loggers returned by Audit, whose lines bypass the
+	// minimum level, sampling and the rate limit.
+	audit bool
+}
+
+// Discard returns an info-level logger that drops every line before doing
+// any work, so it is safe to call at high frequency, e.g. to keep tests and
+// benchmarks quiet. If IsFatal is set on it, calls still run the fatal hooks
+// and terminate the process as configured with SetFatalBehavior, without
+// writing the line.
+func Discard() *Logger {
+	return &Logger{Level: "info", discard: true}
+}
+
+// WithCallerSkip returns a copy of the logger that skips n additional stack
+// frames when reporting file, func and line. Helpers that wrap a logger can
+// use it so lines point at the helper's caller rather than the helper.
+func (logger *Logger) WithCallerSkip(n int) *Logger {
+	child := *logger
+	child.callerSkip += n
+	return &child
+}
+
+// contextFieldsKey is the context key under which ContextWithFields stores
+// its fields.
+type contextFieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying args in addition to any
+// fields already stored in ctx. Loggers bound to the context with WithContext
+// or FromContext add them to every line they write.
+func ContextWithFields(ctx context.Context, args Args) context.Context {
+	fields := make(Fields, len(args))
+	for k, v := range args {
+		fields[k] = v
+	}
+
+	return context.WithValue(ctx, contextFieldsKey{}, mergeFields(contextFields(ctx), fields))
+}
+
+// contextFields returns the fields stored in ctx, if any.
+func contextFields(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(contextFieldsKey{}).(Fields)
+	return fields
+}
+
+// FromContext returns an info-level logger that adds the fields stored in ctx
+// to every line it writes.
+func FromContext(ctx context.Context) *Logger {
+	return Info().WithContext(ctx)
+}
+
+// WithContext returns a copy of the logger that adds the fields stored in ctx
+// to every line it writes. Fields set on the logger itself or passed to an
+// individual call take precedence over context fields.
+func (logger *Logger) WithContext(ctx context.Context) *Logger {
+	child := *logger
+	child.ctx = ctx
+	return &child
+}
+
+// inheritedFields returns the fields the logger adds to every line.
+func (logger *Logger) inheritedFields() Fields {
+	if ctxFields := contextFields(logger.ctx); len(ctxFields) > 0 {
+		return mergeFields(ctxFields, logger.fields)
+	}
+	return logger.fields
+}
+
+// WithFields returns a copy of the logger that adds fields to every line it
+// writes. Fields passed to an individual call override inherited fields with
+// the same key. The receiver is not modified.
+func (logger *Logger) WithFields(fields Args) *Logger {
+	overrides := make(Fields, len(fields))
+	for k, v := range fields {
+		overrides[k] = v
+	}
+
+	child := *logger
+	child.fields = mergeFields(logger.fields, overrides)
+	return &child
+}
+
+// Clone returns an independent copy of the logger, with the same level,
+// caller skip, fields, context and error, which can be modified without
+// affecting the receiver. Outputs are set for the whole package, so they are
+// shared by every logger.
+func (logger *Logger) Clone() *Logger {
+	clone := *logger
+	if logger.fields != nil {
+		clone.fields = mergeFields(nil, logger.fields)
+	}
+	return &clone
+}
+
+// WithError returns a copy of the logger that adds err, and the errors it
+// wraps, to every line it writes, like LogErr does. An error passed to an
+// individual call takes precedence. A nil err returns the receiver as-is.
+func (logger *Logger) WithError(err error) *Logger {
+	if err == nil {
+		return logger
+	}
+
+	child := *logger
+	child.err = err
+	return &child
+}
+
+// mergeFields returns a new map containing base and overrides, with
+// overrides taking precedence on key collisions.
+func mergeFields(base, overrides Fields) Fields {
+	merged := make(Fields, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
 }
 
 // Log writes a log line to stdout.
@@ -56,6 +269,23 @@ func (logger *Logger) LogArgs(msgTemplate string, args Args) {
 	logger.logGenericArgs(msgTemplate, nil, args, 1)
 }
 
+// LogFields writes a log line containing the key-value pairs supplied in
+// fields to stdout, preserving the JSON type of each value.
+func (logger *Logger) LogFields(msgTemplate string, fields Fields) {
+	kind := msgPlain
+	if fields != nil {
+		kind = msgTemplated
+	}
+	logger.logGeneric(msgTemplate, kind, nil, nil, fields, 1)
+}
+
+// Logf writes a log line whose msg is format formatted with fmt.Sprintf, and
+// whose msgTemplate is format. It is a lighter alternative to LogArgs for
+// messages that don't need named args.
+func (logger *Logger) Logf(format string, a ...interface{}) {
+	logger.logFormat(format, a, 1)
+}
+
 // LogErr writes a log line containing an error to stdout.
 func (logger *Logger) LogErr(msg string, err error) {
 	logger.logGenericArgs(msg, err, nil, 1)
@@ -67,79 +297,463 @@ func (logger *Logger) LogErrArgs(msgTemplate string, err error, args Args) {
 	logger.logGenericArgs(msgTemplate, err, args, 1)
 }
 
+// LogReturnErr writes a log line containing an error, like LogErr, and
+// returns err, so that a failure can be logged and passed on in one
+// statement:
+//
+//	return logging.Error().LogReturnErr("failed to download bundle", err)
+func (logger *Logger) LogReturnErr(msg string, err error) error {
+	logger.logGenericArgs(msg, err, nil, 1)
+	return err
+}
+
+// LogReturnErrArgs writes a log line like LogErrArgs and returns err.
+func (logger *Logger) LogReturnErrArgs(msgTemplate string, err error, args Args) error {
+	logger.logGenericArgs(msgTemplate, err, args, 1)
+	return err
+}
+
+// isEnabled reports whether the logger's lines are currently written.
+func (logger *Logger) isEnabled() bool {
+	return logger.IsFatal || (!logger.discard && (logger.audit || IsEnabled(logger.Level)))
+}
+
 // If args is nil, then msgTemplate is not really a template; it's just the msg.
 // stackDepth is the distance from the callee's stack frame to the stack frame
 // of the user code that called into our humble logger
 func (logger *Logger) logGenericArgs(msgTemplate string, err error, args Args, stackDepth int) {
-	file, function, line := GetStackInfo(stackDepth + 1)
-	msg := msgTemplate
+	if !logger.isEnabled() {
+		return
+	}
+
+	var fields Fields
 	if args != nil {
-		t, templateErr := template.New("").Parse(msgTemplate)
-		if templateErr != nil {
-			// While we're sure this is the developer's fault,
-			// and this is typically the kind of scenario where we'd panic at yell at them,
-			// let's not panic here, because it's especially easy to have logging code
-			// that is hard to test (certain kinds of error reporting, for example).
-			// Instead let's make the best of the situation.
-			args["_templateErr"] = templateErr.Error()
+		fields = make(Fields, len(args))
+		for k, v := range args {
+			fields[k] = v
+		}
+	}
+
+	kind := msgPlain
+	if args != nil {
+		kind = msgTemplated
+	}
+	logger.logGeneric(msgTemplate, kind, nil, err, fields, stackDepth+1)
+}
+
+// warnedLevels holds the unknown levels that have been warned about.
+var warnedLevels sync.Map
+
+// withUnknownLevel returns a copy of the logger, whose level isn't known,
+// with the info level instead, warning about the unknown level the first
+// time it is seen.
+func (logger *Logger) withUnknownLevel() *Logger {
+	if _, warned := warnedLevels.LoadOrStore(logger.Level, true); !warned {
+		warnLogger.LogArgs("unknown log level {{.level}} written as info", Args{"level": logger.Level})
+	}
+
+	child := *logger
+	child.Level = "info"
+	return &child
+}
+
+// logFormat is logGeneric for Logf and the package-level shortcuts.
+func (logger *Logger) logFormat(format string, a []interface{}, stackDepth int) {
+	logger.logGeneric(format, msgFormatted, a, nil, nil, stackDepth+1)
+}
+
+// msgKind determines how logGeneric derives the msg from msgTemplate.
+type msgKind int
+
+const (
+	// msgPlain uses msgTemplate as the msg as-is, even if fields are given.
+	msgPlain msgKind = iota
+
+	// msgTemplated executes msgTemplate as a text/template with the fields.
+	msgTemplated
+
+	// msgFormatted formats the formatArgs with msgTemplate as the format.
+	msgFormatted
+)
+
+// logGeneric writes a log line, deriving the msg from msgTemplate as
+// determined by kind.
+func (logger *Logger) logGeneric(msgTemplate string, kind msgKind, formatArgs []interface{}, err error, fields Fields, stackDepth int) {
+	if !logger.isEnabled() {
+		return
+	}
+
+	if _, ok := levelRanks[logger.Level]; !ok {
+		logger = logger.withUnknownLevel()
+	}
+
+	if err == nil {
+		err = logger.err
+	}
+
+	opts := loadOptions()
+	if logger.discard {
+		terminate(opts, msgTemplate)
+		return
+	}
+	write, sampledDropped := true, uint64(0)
+	if !logger.audit {
+		write, sampledDropped = opts.sample(logger.Level, msgTemplate)
+	}
+	if !write {
+		return
+	}
+	if opts.rateLimiter != nil && !logger.IsFatal && !logger.audit && logger.rateLimited == 0 {
+		ok, report := opts.rateLimiter.allow(time.Now())
+		if !ok {
+			return
+		}
+		if report > 0 {
+			reportRateLimited(report, stackDepth+1)
+		}
+	}
+
+	stackDepth += logger.callerSkip
+	var file, function, line string
+	if !opts.callerDisabled {
+		if logger.callerPC != 0 {
+			file, function, line = frameInfo(logger.callerPC, opts.fullFilePath, opts.fullFuncName)
 		} else {
-			var buf bytes.Buffer
-			templateErr := t.Execute(&buf, args)
-			if templateErr != nil {
-				// see above comment about panicking.
-				args["_templateErr"] = templateErr.Error()
-			} else {
-				msg = buf.String()
+			file, function, line = stackInfo(stackDepth+1, opts.fullFilePath, opts.fullFuncName)
+		}
+	}
+	var seq string
+	if opts.sequence {
+		seq = strconv.FormatUint(sequence.Add(1), 10)
+	}
+	var goroutine string
+	if opts.goroutineID {
+		goroutine = goroutineID()
+	}
+	var stack string
+	if opts.captureStack[logger.Level] {
+		stack = captureStack(stackDepth + 1)
+	}
+	msg := msgTemplate
+	var templateErr error
+	inherited := logger.inheritedFields()
+	if fields != nil && len(inherited) > 0 {
+		fields = mergeFields(inherited, fields)
+	} else if fields == nil {
+		fields = inherited
+	}
+	fields = opts.redactFields(resolveLazyFields(fields))
+
+	var missingKeys []string
+	switch kind {
+	case msgFormatted:
+		msg = fmt.Sprintf(msgTemplate, formatArgs...)
+	case msgTemplated:
+		// While we're sure a template error is the developer's fault,
+		// and this is typically the kind of scenario where we'd panic at yell at them,
+		// let's not panic here, because it's especially easy to have logging code
+		// that is hard to test (certain kinds of error reporting, for example).
+		// Instead let's make the best of the situation and report it as an arg.
+		var rendered string
+		if rendered, missingKeys, templateErr = opts.renderTemplate(msgTemplate, fields); templateErr == nil {
+			msg = rendered
+		}
+	}
+	msg = opts.redactString(msg)
+	msgTemplate = opts.redactString(msgTemplate)
+	if opts.sanitizeNewlines {
+		msg = newlineEscaper.Replace(msg)
+		msgTemplate = newlineEscaper.Replace(msgTemplate)
+	}
+
+	timestamp := opts.formatTime(time.Now())
+	buf := getBuffer()
+	var encodeErr error
+	_, isJSON := opts.formatter.(JSONFormatter)
+	if isJSON && len(fields) == 0 && templateErr == nil && len(missingKeys) == 0 && err == nil && stack == "" && sampledDropped == 0 && logger.rateLimited == 0 && !opts.nestedCaller {
+		// Lines without fields or an error are the common case, so they
+		// skip building a map and are written directly.
+		fixed := make([]fixedField, 0, 16)
+		fixed = append(fixed,
+			fixedField{opts.fieldName("time"), timestamp},
+			fixedField{opts.fieldName("level"), logger.Level},
+			fixedField{opts.fieldName("msg"), msg},
+			fixedField{opts.fieldName("msgTemplate"), msgTemplate},
+		)
+		if !opts.callerDisabled {
+			fixed = append(fixed,
+				fixedField{opts.fieldName("file"), file},
+				fixedField{opts.fieldName("func"), function},
+				fixedField{opts.fieldName("line"), line},
+			)
+		}
+		if logger.audit {
+			fixed = append(fixed, fixedField{AuditField, "true"})
+		}
+		if opts.commit != "" {
+			fixed = append(fixed, fixedField{"commit", opts.commit})
+		}
+		if opts.env != "" {
+			fixed = append(fixed, fixedField{"env", opts.env})
+		}
+		if goroutine != "" {
+			fixed = append(fixed, fixedField{"goroutine", goroutine})
+		}
+		fixed = append(fixed,
+			fixedField{"host", opts.host},
+			fixedField{"pid", loggerPID},
+			fixedField{opts.fieldName("process"), loggerExeName},
+		)
+		if seq != "" {
+			fixed = append(fixed, fixedField{"seq", seq})
+		}
+		if opts.version != "" {
+			fixed = append(fixed, fixedField{"version", opts.version})
+		}
+		encodeFixedFields(buf, fixed)
+	} else {
+		fullArgs := Fields{
+			"msgTemplate": msgTemplate,
+			"msg":         msg,
+			"time":        timestamp,
+			"level":       logger.Level,
+			"process":     loggerExeName,
+			"host":        opts.host,
+			"pid":         loggerPID,
+		}
+
+		if !opts.callerDisabled && opts.nestedCaller {
+			lineNumber, _ := strconv.Atoi(line)
+			fullArgs["caller"] = callerInfo{File: file, Func: function, Line: lineNumber}
+		} else if !opts.callerDisabled {
+			fullArgs["file"] = file
+			fullArgs["func"] = function
+			fullArgs["line"] = line
+		}
+
+		for k, v := range fields {
+			fullArgs["arg_"+k] = v
+		}
+
+		if templateErr != nil {
+			fullArgs["arg__templateErr"] = templateErr.Error()
+		}
+
+		if len(missingKeys) > 0 {
+			fullArgs["arg__missingKeys"] = missingKeys
+		}
+
+		if err != nil {
+			fullArgs["error"] = opts.redactString(err.Error())
+			if chain := errorChain(err); len(chain) > 1 {
+				for i := range chain {
+					chain[i] = opts.redactString(chain[i])
+				}
+				fullArgs["errorChain"] = chain
 			}
 		}
+
+		if seq != "" {
+			fullArgs["seq"] = seq
+		}
+
+		if logger.audit {
+			fullArgs[AuditField] = "true"
+		}
+
+		if opts.version != "" {
+			fullArgs["version"] = opts.version
+		}
+
+		if opts.commit != "" {
+			fullArgs["commit"] = opts.commit
+		}
+
+		if opts.env != "" {
+			fullArgs["env"] = opts.env
+		}
+
+		if goroutine != "" {
+			fullArgs["goroutine"] = goroutine
+		}
+
+		if stack != "" {
+			fullArgs["stack"] = stack
+		}
+
+		if sampledDropped > 0 {
+			fullArgs["sampledDropped"] = strconv.FormatUint(sampledDropped, 10)
+		}
+
+		if logger.rateLimited > 0 {
+			fullArgs["rateLimited"] = strconv.FormatUint(logger.rateLimited, 10)
+		}
+
+		if opts.sanitizeNewlines {
+			escapeNewlines(fullArgs)
+		}
+
+		if colorizer, ok := opts.formatter.(colorFormatter); ok && opts.useColor(logger.Level) {
+			encodeErr = colorizer.formatColor(buf, fullArgs)
+		} else {
+			encodeErr = opts.formatter.Format(buf, fullArgs)
+		}
 	}
 
-	fullArgs := Args{
-		"msgTemplate": msgTemplate,
-		"msg":         msg,
-		"time":        time.Now().Format(time.RFC3339Nano),
-		"level":       logger.Level,
-		"file":        file,
-		"func":        function,
-		"line":        line,
-		"process":     loggerExeName,
+	if encodeErr == nil && opts.metricsHook != nil {
+		opts.metricsHook(logger.Level)
 	}
 
-	for k, v := range args {
-		fullArgs["arg_"+k] = v
+	if !logger.IsFatal {
+		if encodeErr == nil && logger.internal {
+			writeInternal(logger.Level, buf)
+		} else if encodeErr == nil {
+			writeLine(logger.Level, buf)
+		} else {
+			putBuffer(buf)
+		}
+		return
 	}
 
-	if err != nil {
-		fullArgs["error"] = err.Error()
+	// Make sure the final line, and everything queued before it, reaches its
+	// destination before the process goes away.
+	Flush()
+	if encodeErr == nil {
+		outputMutex.Lock()
+		w := outputFor(logger.Level)
+		w.Write(buf.Bytes())
+		if file, ok := w.(*os.File); ok {
+			file.Sync()
+		}
+		outputMutex.Unlock()
+	}
+	putBuffer(buf)
+
+	terminate(opts, msg)
+}
+
+// terminate ends the process after a fatal line with msg was written.
+func terminate(opts *options, msg string) {
+	runFatalHooks()
+	if opts.fatalBehavior == FatalExit {
+		exit(1)
+		return
+	}
+	panic(msg)
+}
+
+// maxErrorChainDepth bounds errorChain in case of a cyclic Unwrap.
+const maxErrorChainDepth = 16
+
+// errorChain returns the message of err and of each error it wraps.
+func errorChain(err error) []string {
+	var chain []string
+	for ; err != nil && len(chain) < maxErrorChainDepth; err = errors.Unwrap(err) {
+		chain = append(chain, err.Error())
 	}
+	return chain
+}
 
-	jsonWriter.Encode(fullArgs)
+// maxStackDepth bounds the number of frames in the "stack" field.
+const maxStackDepth = 32
+
+// frameInfo is stackInfo for a program counter as returned by
+// runtime.Callers.
+func frameInfo(pc uintptr, fullFilePath, fullFuncName bool) (string, string, string) {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.Function == "" {
+		return "?", "?()", "0"
+	}
 
-	if logger.IsFatal {
-		panic(msg)
+	file := frame.File
+	if !fullFilePath {
+		file = filepath.Base(file)
 	}
+
+	function := frame.Function
+	if !fullFuncName {
+		function = strings.TrimLeft(filepath.Ext(function), ".")
+	}
+	return file, function + "()", Int(frame.Line)
+}
+
+// captureStack returns the call stack starting at the frame specified by
+// stackDepth, one "function (file:line)" frame per line.
+func captureStack(stackDepth int) string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(stackDepth+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack strings.Builder
+	for {
+		frame, more := frames.Next()
+		if stack.Len() > 0 {
+			stack.WriteRune('\n')
+		}
+		stack.WriteString(frame.Function)
+		stack.WriteString(" (")
+		stack.WriteString(filepath.Base(frame.File))
+		stack.WriteRune(':')
+		stack.WriteString(Int(frame.Line))
+		stack.WriteRune(')')
+		if !more {
+			break
+		}
+	}
+	return stack.String()
 }
 
 // GetStackInfo returns the file, function, and line of the stack frame
 // specified by stackDepth.
 func GetStackInfo(stackDepth int) (string, string, string) {
+	return stackInfo(stackDepth+1, false, false)
+}
+
+// stackInfo is GetStackInfo with the option of reporting the full path of
+// the file as returned by runtime.Caller instead of its base name, and the
+// package-qualified name of the function instead of its short name.
+func stackInfo(stackDepth int, fullFilePath, fullFuncName bool) (string, string, string) {
 	resultFile := "?"
 	resultFunc := "?()"
 	resultLine := "0"
 
 	if pc, file, line, ok := runtime.Caller(stackDepth + 1); ok {
-		resultFile = filepath.Base(file)
+		resultFile = file
+		if !fullFilePath {
+			resultFile = filepath.Base(file)
+		}
 		resultLine = Int(line)
 		if fn := runtime.FuncForPC(pc); fn != nil {
-			dotName := filepath.Ext(fn.Name())
-			resultFunc = strings.TrimLeft(dotName, ".") + "()"
+			if fullFuncName {
+				resultFunc = fn.Name() + "()"
+			} else {
+				dotName := filepath.Ext(fn.Name())
+				resultFunc = strings.TrimLeft(dotName, ".") + "()"
+			}
 		}
 	}
 	return resultFile, resultFunc, resultLine
 }
 
 var (
-	jsonWriter *json.Encoder
+	// levels lists the supported levels from least to most severe.
+	levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+	// levelRanks maps each level to its position in levels.
+	levelRanks = map[string]int32{}
+
+	// minLevelRank is the rank below which log lines are dropped. It is
+	// accessed atomically.
+	minLevelRank int32
+
+	// outputs holds the destination of each level.
+	outputs map[string]io.Writer
+
+	// terminalOutputs records which levels write to a terminal.
+	terminalOutputs = map[string]bool{}
+
+	// outputMutex guards outputs and serializes writes to them.
+	outputMutex sync.Mutex
 
 	traceLogger *Logger
 	debugLogger *Logger
@@ -147,14 +761,98 @@ var (
 	warnLogger  *Logger
 	errorLogger *Logger
 	fatalLogger *Logger
+	auditLogger *Logger
 
 	loggerExeName string
+	loggerPID     string
+
+	// currentOptions holds the *options read on every log line.
+	currentOptions atomic.Value
+
+	// optionsMutex serializes updates to currentOptions.
+	optionsMutex sync.Mutex
 )
 
+// options holds package-level settings. A published options value is never
+// modified; updateOptions replaces it with a modified copy instead, so log
+// calls can read it without locking.
+type options struct {
+	host string
+
+	version string
+	commit  string
+	env     string
+
+	timeFormat string
+	timeZone   *time.Location
+
+	fatalBehavior FatalBehavior
+
+	// captureStack holds the levels whose lines include a "stack" field.
+	captureStack map[string]bool
+
+	fullFilePath   bool
+	fullFuncName   bool
+	callerDisabled bool
+	goroutineID    bool
+	nestedCaller   bool
+	sequence       bool
+
+	sanitizeNewlines bool
+
+	metricsHook func(level string)
+
+	formatter Formatter
+	color     ColorMode
+
+	// redactedKeys holds the arg names whose values are redacted.
+	redactedKeys map[string]bool
+
+	// redactedPatterns match substrings of values that are redacted.
+	redactedPatterns []*regexp.Regexp
+
+	// sampling maps sampled levels to the N of every N-th line written.
+	sampling map[string]uint64
+
+	rateLimiter *rateLimiter
+
+	// fieldNames maps reserved keys to the names they are written with.
+	fieldNames map[string]string
+
+	// templateOption is applied to message templates when not empty.
+	templateOption string
+}
+
+// formatTime renders t for the "time" field.
+func (opts *options) formatTime(t time.Time) string {
+	if opts.timeZone != nil {
+		t = t.In(opts.timeZone)
+	}
+	return t.Format(opts.timeFormat)
+}
+
+func loadOptions() *options {
+	return currentOptions.Load().(*options)
+}
+
+func updateOptions(update func(*options)) {
+	optionsMutex.Lock()
+	defer optionsMutex.Unlock()
+
+	opts := *loadOptions()
+	update(&opts)
+	currentOptions.Store(&opts)
+}
+
 func init() {
-	jsonWriter = json.NewEncoder(os.Stdout)
-	jsonWriter.SetEscapeHTML(false)
-	jsonWriter.SetIndent("", "")
+	for i, level := range levels {
+		levelRanks[level] = int32(i)
+	}
+
+	outputs = make(map[string]io.Writer, len(levels))
+	SetOutput(os.Stdout)
+	SetLevelOutput("error", os.Stderr)
+	SetLevelOutput("fatal", os.Stderr)
 
 	// These string representations match the ones for fluentd:
 	// https://docs.fluentd.org/v1.0/articles/logging#log-level
@@ -164,8 +862,347 @@ func init() {
 	warnLogger = &Logger{Level: "warn", IsFatal: false}
 	errorLogger = &Logger{Level: "error", IsFatal: false}
 	fatalLogger = &Logger{Level: "fatal", IsFatal: true}
+	auditLogger = &Logger{Level: "info", IsFatal: false, audit: true}
 
 	loggerExeName = filepath.Base(os.Args[0])
+	loggerPID = Int(os.Getpid())
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "?"
+	}
+	currentOptions.Store(&options{
+		host:       host,
+		timeFormat: time.RFC3339Nano,
+		formatter:  JSONFormatter{},
+	})
+}
+
+// FatalBehavior determines how the process is terminated after a fatal log.
+type FatalBehavior int
+
+const (
+	// FatalPanic panics with the log message. This is the default.
+	FatalPanic FatalBehavior = iota
+
+	// FatalExit exits the process with status 1 without unwinding the
+	// stack, so no panic trace ends up in the log stream.
+	FatalExit
+)
+
+// exit terminates the process. It is a variable so tests can replace it.
+var exit = os.Exit
+
+var (
+	// fatalHooks are run, most recently registered first, before a fatal
+	// log terminates the process.
+	fatalHooks      []func()
+	fatalHooksMutex sync.Mutex
+)
+
+// RegisterFatalHook registers hook to be run after a fatal log line has been
+// written but before the process panics or exits, e.g. to close connections.
+// Hooks run in the reverse order of registration.
+func RegisterFatalHook(hook func()) {
+	fatalHooksMutex.Lock()
+	defer fatalHooksMutex.Unlock()
+	fatalHooks = append(fatalHooks, hook)
+}
+
+func runFatalHooks() {
+	fatalHooksMutex.Lock()
+	hooks := make([]func(), len(fatalHooks))
+	copy(hooks, fatalHooks)
+	fatalHooksMutex.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		runFatalHook(hooks[i])
+	}
+}
+
+// runFatalHook runs hook, recovering from any panic so the remaining hooks
+// still get to run.
+func runFatalHook(hook func()) {
+	defer func() {
+		recover()
+	}()
+	hook()
+}
+
+// SetFatalBehavior sets how fatal logs terminate the process. In either case
+// the fatal line is fully written first.
+func SetFatalBehavior(behavior FatalBehavior) {
+	updateOptions(func(opts *options) {
+		opts.fatalBehavior = behavior
+	})
+}
+
+// SetCaptureStack enables or disables the "stack" field for lines of the
+// given level. Capturing the stack is relatively expensive, so it is
+// typically only enabled for error and fatal.
+func SetCaptureStack(level string, enabled bool) {
+	updateOptions(func(opts *options) {
+		captureStack := make(map[string]bool, len(opts.captureStack)+1)
+		for k, v := range opts.captureStack {
+			captureStack[k] = v
+		}
+		captureStack[level] = enabled
+		opts.captureStack = captureStack
+	})
+}
+
+// SetMetricsHook registers hook to be called with the level of every line
+// that is written, e.g. to increment a Prometheus counter. Lines dropped by
+// SetMinLevel never reach the hook. The hook is called synchronously from
+// the logging call, so it must be cheap and must not log. A nil hook
+// disables it.
+func SetMetricsHook(hook func(level string)) {
+	updateOptions(func(opts *options) {
+		opts.metricsHook = hook
+	})
+}
+
+// SetCaller controls whether lines include the file, func and line of the
+// caller, which is the default. Resolving the caller is measurable overhead
+// on every line, so throughput-sensitive programs may want to disable it.
+func SetCaller(enabled bool) {
+	updateOptions(func(opts *options) {
+		opts.callerDisabled = !enabled
+	})
+}
+
+// SetSanitizeNewlines controls whether carriage returns and newlines in
+// string values, e.g. in multi-line error messages, are replaced with the
+// visible escapes \r and \n before the line is encoded, so that the values
+// stay on one line even for consumers that decode and re-serialize lines.
+// It is disabled by default.
+func SetSanitizeNewlines(enabled bool) {
+	updateOptions(func(opts *options) {
+		opts.sanitizeNewlines = enabled
+	})
+}
+
+// newlineEscaper replaces line breaks for SetSanitizeNewlines.
+var newlineEscaper = strings.NewReplacer("\r", `\r`, "\n", `\n`)
+
+// escapeNewlines applies newlineEscaper to the string values of fullArgs,
+// including the elements of string slices such as errorChain.
+func escapeNewlines(fullArgs Fields) {
+	for k, v := range fullArgs {
+		switch v := v.(type) {
+		case string:
+			fullArgs[k] = newlineEscaper.Replace(v)
+		case []string:
+			escaped := make([]string, len(v))
+			for i := range v {
+				escaped[i] = newlineEscaper.Replace(v[i])
+			}
+			fullArgs[k] = escaped
+		}
+	}
+}
+
+// sequence numbers the lines written with SetSequence.
+var sequence atomic.Uint64
+
+// SetSequence controls whether lines include a "seq" field numbering them in
+// the order they were logged, across all loggers and goroutines, so that
+// consumers of lossy outputs can detect gaps. It is disabled by default.
+// Lines dropped by sampling or the rate limit aren't numbered.
+func SetSequence(enabled bool) {
+	updateOptions(func(opts *options) {
+		opts.sequence = enabled
+	})
+}
+
+// SetGoroutineID controls whether lines include the ID of the goroutine that
+// logged them in the "goroutine" field, to group the lines of interleaved
+// concurrent work. IDs are only meaningful for correlating lines within one
+// run of the program; they aren't stable across runs. Finding the ID means
+// formatting the goroutine's stack, so it is disabled by default.
+func SetGoroutineID(enabled bool) {
+	updateOptions(func(opts *options) {
+		opts.goroutineID = enabled
+	})
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from the
+// "goroutine 123 [running]:" header of its stack trace.
+func goroutineID() string {
+	var header [64]byte
+	n := runtime.Stack(header[:], false)
+	id := bytes.TrimPrefix(header[:n], []byte("goroutine "))
+	if i := bytes.IndexByte(id, ' '); i > 0 {
+		return string(id[:i])
+	}
+	return "?"
+}
+
+// SetNestedCaller controls whether the file, func and line of the caller are
+// grouped in a "caller" object, with line as a number, instead of being
+// written as three top-level fields, which is the default:
+//
+//	"caller": {"file": "main.go", "func": "main()", "line": 42}
+func SetNestedCaller(enabled bool) {
+	updateOptions(func(opts *options) {
+		opts.nestedCaller = enabled
+	})
+}
+
+// callerInfo is the "caller" field written with SetNestedCaller.
+type callerInfo struct {
+	File string `json:"file"`
+	Func string `json:"func"`
+	Line int    `json:"line"`
+}
+
+// SetFullFilePath controls whether the "file" field holds the full path of
+// the source file instead of just its base name, which is the default.
+func SetFullFilePath(enabled bool) {
+	updateOptions(func(opts *options) {
+		opts.fullFilePath = enabled
+	})
+}
+
+// SetFullFuncName controls whether the "func" field holds the package-qualified
+// function name, e.g. "github.com/limitz404/lokalise-listener/lokalise.TaskCompletedHandler()",
+// instead of just "TaskCompletedHandler()", which is the default.
+func SetFullFuncName(enabled bool) {
+	updateOptions(func(opts *options) {
+		opts.fullFuncName = enabled
+	})
+}
+
+// SetTimeFormat sets the layout, as understood by time.Time.Format, used for
+// the "time" field. The default is time.RFC3339Nano.
+func SetTimeFormat(layout string) {
+	updateOptions(func(opts *options) {
+		opts.timeFormat = layout
+	})
+}
+
+// SetTimeZone sets the location the "time" field is rendered in, e.g.
+// time.UTC. A nil location restores the default, which is the local zone.
+func SetTimeZone(loc *time.Location) {
+	updateOptions(func(opts *options) {
+		opts.timeZone = loc
+	})
+}
+
+// SetHost overrides the "host" field, which defaults to the hostname. This is
+// useful where the hostname is meaningless, e.g. to substitute a pod name.
+func SetHost(host string) {
+	updateOptions(func(opts *options) {
+		opts.host = host
+	})
+}
+
+// SetBuildInfo adds "version" and "commit" fields to every line, e.g. to tell
+// which deploy wrote it. Empty values leave the field out, which is the
+// default. BuildInfo returns the values stamped into the binary by the Go
+// toolchain:
+//
+//	logging.SetBuildInfo(logging.BuildInfo())
+func SetBuildInfo(version, commit string) {
+	updateOptions(func(opts *options) {
+		opts.version = version
+		opts.commit = commit
+	})
+}
+
+// SetEnv adds an "env" field to every line, e.g. "staging" or "production",
+// to tell apart the lines of several environments sharing a log store. An
+// empty env leaves the field out, which is the default.
+func SetEnv(env string) {
+	updateOptions(func(opts *options) {
+		opts.env = env
+	})
+}
+
+// BuildInfo returns the main module version and the VCS revision recorded in
+// the binary, if any. The version is empty for binaries built from a working
+// tree, which report it as "(devel)".
+func BuildInfo() (version, commit string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", ""
+	}
+
+	if info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			commit = setting.Value
+		}
+	}
+	return version, commit
+}
+
+// outputFor returns the writer for level. Levels that aren't known to the
+// package share the info-level writer. The caller must hold outputMutex.
+func outputFor(level string) io.Writer {
+	if w, ok := outputs[level]; ok {
+		return w
+	}
+	return outputs["info"]
+}
+
+// SetOutput redirects all subsequent log lines, regardless of level, to w.
+// By default trace through warn are written to stdout while error and fatal
+// are written to stderr.
+func SetOutput(w io.Writer) {
+	for _, level := range levels {
+		SetLevelOutput(level, w)
+	}
+}
+
+// SetLevelOutput redirects all subsequent log lines of the given level to w.
+func SetLevelOutput(level string, w io.Writer) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	outputs[level] = w
+	terminalOutputs[level] = isTerminal(w)
+}
+
+// Levels returns the log levels, from least to most severe.
+func Levels() []string {
+	return append([]string(nil), levels...)
+}
+
+// LevelOutput returns the writer that log lines of the given level are
+// currently written to, e.g. so that it can be restored after SetLevelOutput.
+func LevelOutput(level string) io.Writer {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	return outputs[level]
+}
+
+// levelRank returns the severity of level. Levels that aren't known to the
+// package are ranked as info.
+func levelRank(level string) int32 {
+	if rank, ok := levelRanks[level]; ok {
+		return rank
+	}
+	return levelRanks["info"]
+}
+
+// SetMinLevel drops all subsequent log lines below level, in the order
+// trace < debug < info < warn < error < fatal. Fatal logs are never dropped.
+func SetMinLevel(level string) error {
+	rank, ok := levelRanks[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	atomic.StoreInt32(&minLevelRank, rank)
+	return nil
+}
+
+// IsEnabled reports whether log lines of the given level are currently
+// written. Callers can use it to skip building expensive Args.
+func IsEnabled(level string) bool {
+	return level == "fatal" || levelRank(level) >= atomic.LoadInt32(&minLevelRank)
 }
 
 // Trace returns a trace-level logger.
@@ -198,6 +1235,90 @@ func Fatal() *Logger {
 	return fatalLogger
 }
 
+// AuditField is the field set to "true" on the lines of Audit loggers.
+const AuditField = "audit"
+
+// Audit returns an info-level logger for the record of the actions taken,
+// e.g. files written or messages sent. Its lines have the AuditField set to
+// "true", so that they can be routed to a store of their own, and are always
+// written, regardless of the minimum level, sampling and the rate limit.
+func Audit() *Logger {
+	return auditLogger
+}
+
+// ParseLevel returns the logger of the level named s, ignoring case and
+// surrounding space, e.g. Info() for "INFO". An error is returned for names
+// that aren't levels.
+func ParseLevel(s string) (*Logger, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace":
+		return Trace(), nil
+	case "debug":
+		return Debug(), nil
+	case "info":
+		return Info(), nil
+	case "warn":
+		return Warn(), nil
+	case "error":
+		return Error(), nil
+	case "fatal":
+		return Fatal(), nil
+	}
+	return nil, fmt.Errorf("unknown log level %q", s)
+}
+
+// LevelFromEnv returns the logger of the level named by the environment
+// variable key, as parsed by ParseLevel. If the variable is unset or empty,
+// the logger of the fallback level is returned, and likewise if it can't be
+// parsed, after logging a warning. Unknown fallbacks mean info.
+func LevelFromEnv(key, fallback string) *Logger {
+	if value := os.Getenv(key); value != "" {
+		logger, err := ParseLevel(value)
+		if err == nil {
+			return logger
+		}
+		Warn().LogErrArgs("ignoring invalid log level in {{.key}}", err, Args{"key": key})
+	}
+
+	logger, err := ParseLevel(fallback)
+	if err != nil {
+		return Info()
+	}
+	return logger
+}
+
+// Package-level shortcuts. Each one is the matching level logger's Logf.
+
+// Tracef writes a formatted trace-level log line.
+func Tracef(format string, a ...interface{}) {
+	traceLogger.logFormat(format, a, 1)
+}
+
+// Debugf writes a formatted debug-level log line.
+func Debugf(format string, a ...interface{}) {
+	debugLogger.logFormat(format, a, 1)
+}
+
+// Infof writes a formatted info-level log line.
+func Infof(format string, a ...interface{}) {
+	infoLogger.logFormat(format, a, 1)
+}
+
+// Warnf writes a formatted warn-level log line.
+func Warnf(format string, a ...interface{}) {
+	warnLogger.logFormat(format, a, 1)
+}
+
+// Errorf writes a formatted error-level log line.
+func Errorf(format string, a ...interface{}) {
+	errorLogger.logFormat(format, a, 1)
+}
+
+// Fatalf writes a formatted fatal-level log line.
+func Fatalf(format string, a ...interface{}) {
+	fatalLogger.logFormat(format, a, 1)
+}
+
 // convenience functions for converting things to string
 
 // JSON converts a valid value to a JSON string. Channels, complex numbers, and
@@ -206,22 +1327,34 @@ func Fatal() *Logger {
 // right out. Pretty much everything else is fair game.
 // Read more: https://golang.org/pkg/encoding/json/#Marshal
 func JSON(j interface{}) string {
-	var buf bytes.Buffer
-	encoder := json.NewEncoder(&buf)
-	encoder.SetEscapeHTML(false)
-	encoder.SetIndent("", "")
-	err := encoder.Encode(j)
-
+	s, err := JSONErr(j)
 	if err == nil {
-		return strings.TrimSuffix(buf.String(), "\n")
+		return s
 	}
 
 	// j could not be serialized to json, so let's log the error and return a
 	// helpful-ish value
-	Error().logGenericArgs("error serializing value to json", err, nil, 1)
+	jsonErrorLogger.logGenericArgs("error serializing value to json", err, nil, 1)
 	return fmt.Sprintf("<error: %v>", err)
 }
 
+// jsonErrorLogger reports the values JSON can't serialize. JSON may be called
+// while a line is being written, e.g. by a Formatter or an output, so the
+// logger must not wait for the output.
+var jsonErrorLogger = &Logger{Level: "error", internal: true}
+
+// JSONErr is JSON for values that may not be serializable: instead of
+// logging the error and returning a placeholder, it returns the error.
+func JSONErr(j interface{}) (string, error) {
+	pair := getJSONEncoder()
+	defer putJSONEncoder(pair)
+
+	if err := pair.encoder.Encode(j); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(pair.buf.Bytes(), []byte("\n"))), nil
+}
+
 // Int converts an int to a base 10 string.
 func Int(i int) string {
 	// The "a" is short for "string", obviously.
@@ -240,12 +1373,42 @@ func Int32(i int32) string {
 	return strconv.FormatInt(int64(i), 10)
 }
 
+// Int16 converts an int16 to a base 10 string.
+func Int16(i int16) string {
+	// Base 10
+	return strconv.FormatInt(int64(i), 10)
+}
+
+// Int8 converts an int8 to a base 10 string.
+func Int8(i int8) string {
+	// Base 10
+	return strconv.FormatInt(int64(i), 10)
+}
+
+// Uint converts a uint to a base 10 string.
+func Uint(i uint) string {
+	// Base 10
+	return strconv.FormatUint(uint64(i), 10)
+}
+
 // Uint32 converts a uint32 to a base 10 string.
 func Uint32(i uint32) string {
 	// Base 10
 	return strconv.FormatUint(uint64(i), 10)
 }
 
+// Uint16 converts a uint16 to a base 10 string.
+func Uint16(i uint16) string {
+	// Base 10
+	return strconv.FormatUint(uint64(i), 10)
+}
+
+// Uint8 converts a uint8 to a base 10 string.
+func Uint8(i uint8) string {
+	// Base 10
+	return strconv.FormatUint(uint64(i), 10)
+}
+
 // Uint64 converts a uint64 to a base 10 string.
 func Uint64(i uint64) string {
 	// Base 10
@@ -257,6 +1420,59 @@ func Float64(i float64) string {
 	return strconv.FormatFloat(i, 'f', -1, 64)
 }
 
+// Float32 converts a float32 to the shortest base 10 string that round-trips
+// as a float32.
+func Float32(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+// Hex converts a byte slice to a lowercase hex string.
+func Hex(b []byte) string {
+	return hex.EncodeToString(b)
+}
+
+// Base64 converts a byte slice to a standard base64 string.
+func Base64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// Err converts an error to its message, or "" for a nil error.
+func Err(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Str converts any value to a string: "" for nil, including nil pointers
+// implementing fmt.Stringer or error, the result of String for a
+// fmt.Stringer, the result of Error for an error and the JSON encoding of
+// anything else.
+func Str(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return ""
+		}
+		return v.String()
+	case error:
+		if isNilPointer(v) {
+			return ""
+		}
+		return v.Error()
+	default:
+		return JSON(v)
+	}
+}
+
+// isNilPointer reports whether v holds a nil pointer.
+func isNilPointer(v interface{}) bool {
+	value := reflect.ValueOf(v)
+	return value.Kind() == reflect.Ptr && value.IsNil()
+}
+
 // Bool converts a bool to a string.
 func Bool(b bool) string {
 	return strconv.FormatBool(b)
@@ -267,7 +1483,49 @@ func Duration(d time.Duration) string {
 	return d.String()
 }
 
-// Time converts a time.Time to a string.
+// DurationMillis converts a time.Duration to a plain decimal number of
+// milliseconds, e.g. "1.5" for 1500µs, so it can be treated as a number
+// downstream.
+func DurationMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
+
+// DurationSeconds converts a time.Duration to a plain decimal number of
+// seconds, e.g. "0.25" for 250ms.
+func DurationSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// HTTPStatus converts an HTTP status code to a string with its reason, e.g.
+// "429 Too Many Requests", or just the code if it is unknown.
+func HTTPStatus(code int) string {
+	if text := http.StatusText(code); len(text) > 0 {
+		return strconv.Itoa(code) + " " + text
+	}
+	return strconv.Itoa(code)
+}
+
+// Time converts a time.Time to a string in the local time zone.
 func Time(t time.Time) string {
 	return t.Local().Format(time.RFC3339Nano)
 }
+
+// TimeUTC converts a time.Time to a string in UTC.
+func TimeUTC(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// TimeIn converts a time.Time to a string in the time zone loc. A nil loc
+// keeps the time's own zone, like TimeRaw.
+func TimeIn(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		return TimeRaw(t)
+	}
+	return t.In(loc).Format(time.RFC3339Nano)
+}
+
+// TimeRaw converts a time.Time to a string in the time's own zone, without
+// any conversion.
+func TimeRaw(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
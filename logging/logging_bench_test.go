@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func BenchmarkLogArgs(b *testing.B) {
+	SetOutput(ioutil.Discard)
+	defer resetOutput()
+
+	args := Args{"project_id": "123", "key_count": "42"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info().LogArgs("project {{.project_id}} exported {{.key_count}} keys", args)
+	}
+}
+
+// BenchmarkLogArgsUncached parses the template on every call, for comparison
+// with BenchmarkLogArgs, which reuses the cached template.
+func BenchmarkLogArgsUncached(b *testing.B) {
+	SetOutput(ioutil.Discard)
+	defer resetOutput()
+	defer resetTemplateCache()
+
+	args := Args{"project_id": "123", "key_count": "42"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resetTemplateCache()
+		Info().LogArgs("project {{.project_id}} exported {{.key_count}} keys", args)
+	}
+}
+
+func BenchmarkLog(b *testing.B) {
+	SetOutput(ioutil.Discard)
+	defer resetOutput()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info().Log("started")
+	}
+}
+
+// BenchmarkLogErr measures the map-based path for comparison with
+// BenchmarkLog, which writes its fixed fields directly.
+func BenchmarkLogErr(b *testing.B) {
+	SetOutput(ioutil.Discard)
+	defer resetOutput()
+
+	err := errors.New("failed")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info().LogErr("started", err)
+	}
+}
+
+func BenchmarkLogWithoutCaller(b *testing.B) {
+	SetOutput(ioutil.Discard)
+	SetCaller(false)
+	defer resetOutput()
+	defer SetCaller(true)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info().Log("started")
+	}
+}
+
+func BenchmarkDiscard(b *testing.B) {
+	args := Args{"project_id": "123", "key_count": "42"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Discard().LogArgs("project {{.project_id}} exported {{.key_count}} keys", args)
+	}
+}
+
+// BenchmarkJSON should report a single allocation, for the returned string,
+// since the buffer and encoder are pooled.
+func BenchmarkJSON(b *testing.B) {
+	value := struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}{42, "<en>"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		JSON(&value)
+	}
+}
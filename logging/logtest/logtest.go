@@ -0,0 +1,87 @@
+// Package logtest helps tests assert on the lines written by the logging
+// package.
+package logtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/limitz404/lokalise-listener/logging"
+)
+
+// Buffer collects the log lines written while a capture is active. It is
+// safe for concurrent use.
+type Buffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+// String returns the raw lines written so far.
+func (b *Buffer) String() string {
+	logging.Flush()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// Entries returns the lines written so far, each parsed back into a map from
+// key to value. String values are returned as-is and other values, such as
+// errorChain or the values of LogFields, as their JSON encoding. Lines that
+// aren't valid JSON are skipped.
+func (b *Buffer) Entries() []map[string]string {
+	var entries []map[string]string
+	for _, line := range strings.Split(b.String(), "\n") {
+		raw := map[string]json.RawMessage{}
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			continue
+		}
+
+		entry := make(map[string]string, len(raw))
+		for key, value := range raw {
+			var s string
+			if err := json.Unmarshal(value, &s); err == nil {
+				entry[key] = s
+			} else {
+				entry[key] = string(value)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Capture redirects the log lines of every level to a new Buffer until
+// restore is called, which reinstates the previous outputs. Calling restore
+// more than once has no further effect.
+func Capture() (buf *Buffer, restore func()) {
+	levels := logging.Levels()
+	previous := make(map[string]io.Writer, len(levels))
+	for _, level := range levels {
+		previous[level] = logging.LevelOutput(level)
+	}
+
+	buf = &Buffer{}
+	logging.SetOutput(buf)
+
+	var once sync.Once
+	restore = func() {
+		once.Do(func() {
+			logging.Flush()
+			for _, level := range levels {
+				logging.SetLevelOutput(level, previous[level])
+			}
+		})
+	}
+	return buf, restore
+}
@@ -0,0 +1,36 @@
+package logtest
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	buf, restore := Capture()
+	defer restore()
+
+	logging.Error().LogErrArgs("export of {{.project_id}} failed", errors.New("boom"), logging.Args{"project_id": "123"})
+	logging.Info().LogFields("counted", logging.Fields{"count": 3})
+
+	entries := buf.Entries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, "123", entries[0]["arg_project_id"])
+	assert.Equal(t, "export of 123 failed", entries[0]["msg"])
+	assert.Equal(t, "boom", entries[0]["error"])
+	assert.Equal(t, "3", entries[1]["arg_count"])
+
+	restore()
+	restore()
+	assert.Equal(t, os.Stdout, logging.LevelOutput("info"))
+	assert.Equal(t, os.Stderr, logging.LevelOutput("error"))
+
+	logging.SetLevelOutput("info", buf)
+	defer logging.SetLevelOutput("info", os.Stdout)
+	restore()
+	assert.Equal(t, buf, logging.LevelOutput("info"))
+}
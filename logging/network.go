@@ -0,0 +1,220 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxNetworkPending bounds the lines held while a network output is
+	// disconnected. The oldest lines are dropped beyond it.
+	maxNetworkPending = 1000
+
+	networkDialTimeout  = 5 * time.Second
+	networkWriteTimeout = 5 * time.Second
+	networkMinBackoff   = 100 * time.Millisecond
+	networkMaxBackoff   = 30 * time.Second
+
+	// networkFlushTimeout bounds how long Flush waits for pending lines to
+	// be sent, since the endpoint may be unreachable.
+	networkFlushTimeout = 5 * time.Second
+)
+
+var (
+	// networkOutput is the output installed by SetNetworkOutput, if any.
+	networkOutput *networkWriter
+
+	// networkOutputMutex guards networkOutput.
+	networkOutputMutex sync.Mutex
+)
+
+// SetNetworkOutput redirects all subsequent log lines, regardless of level,
+// to a stream connection, e.g. a Fluent Bit TCP input or another collector
+// that accepts newline-delimited lines. The connection is dialed once up
+// front, and an error is returned if that fails.
+//
+// Lines are sent in the background, so logging calls never wait on the
+// network. If the connection fails, it is redialed with exponential backoff
+// and up to 1000 lines are held in the meantime, dropping the oldest beyond
+// that. Flush, which runs before the process exits on a fatal line, waits up
+// to five seconds for the held lines to be sent.
+func SetNetworkOutput(network, address string) error {
+	conn, err := net.DialTimeout(network, address, networkDialTimeout)
+	if err != nil {
+		return fmt.Errorf("dialing log output %s %s: %w", network, address, err)
+	}
+
+	writer := newNetworkWriter(func() (net.Conn, error) {
+		return net.DialTimeout(network, address, networkDialTimeout)
+	})
+	writer.conn = conn
+	go writer.run()
+
+	networkOutputMutex.Lock()
+	previous := networkOutput
+	networkOutput = writer
+	networkOutputMutex.Unlock()
+
+	SetOutput(writer)
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// networkWriter queues lines and sends them over a connection it redials
+// whenever it fails.
+type networkWriter struct {
+	dial func() (net.Conn, error)
+
+	mutex   sync.Mutex
+	wake    *sync.Cond
+	pending [][]byte
+	sending bool
+	closed  bool
+
+	// stopped is set once run has returned, after which nothing is sent.
+	stopped bool
+
+	// conn is only used by run once it has started.
+	conn net.Conn
+
+	done chan struct{}
+}
+
+func newNetworkWriter(dial func() (net.Conn, error)) *networkWriter {
+	writer := &networkWriter{
+		dial: dial,
+		done: make(chan struct{}),
+	}
+	writer.wake = sync.NewCond(&writer.mutex)
+	return writer
+}
+
+// Write implements io.Writer. It queues a copy of p and never blocks on the
+// network.
+func (writer *networkWriter) Write(p []byte) (int, error) {
+	line := append([]byte(nil), p...)
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return 0, fmt.Errorf("log output closed")
+	}
+	if len(writer.pending) >= maxNetworkPending {
+		writer.pending = writer.pending[1:]
+	}
+	writer.pending = append(writer.pending, line)
+	writer.wake.Signal()
+	return len(p), nil
+}
+
+// Flush waits until the queued lines have been sent, for up to
+// networkFlushTimeout, or fails straight away if the writer was closed
+// before sending them.
+func (writer *networkWriter) Flush() error {
+	deadline := time.Now().Add(networkFlushTimeout)
+	for {
+		writer.mutex.Lock()
+		remaining := len(writer.pending)
+		if writer.sending {
+			remaining++
+		}
+		stopped := writer.stopped
+		writer.mutex.Unlock()
+
+		if remaining == 0 {
+			return nil
+		}
+		if stopped {
+			return fmt.Errorf("%d log lines not sent before the output was closed", remaining)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d log lines not yet sent", remaining)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Close stops sending once the queued lines are sent or, if the connection
+// is down, immediately.
+func (writer *networkWriter) Close() {
+	writer.mutex.Lock()
+	if !writer.closed {
+		writer.closed = true
+		close(writer.done)
+		writer.wake.Signal()
+	}
+	writer.mutex.Unlock()
+}
+
+// run sends the queued lines until the writer is closed.
+func (writer *networkWriter) run() {
+	defer func() {
+		if writer.conn != nil {
+			writer.conn.Close()
+		}
+
+		// A line still being retried when closed is dropped, so Flush
+		// mustn't wait for it.
+		writer.mutex.Lock()
+		writer.sending = false
+		writer.stopped = true
+		writer.mutex.Unlock()
+	}()
+
+	backoff := networkMinBackoff
+	for {
+		writer.mutex.Lock()
+		for len(writer.pending) == 0 && !writer.closed {
+			writer.wake.Wait()
+		}
+		if len(writer.pending) == 0 {
+			writer.mutex.Unlock()
+			return
+		}
+		line := writer.pending[0]
+		writer.pending = writer.pending[1:]
+		writer.sending = true
+		writer.mutex.Unlock()
+
+		for !writer.send(line) {
+			select {
+			case <-writer.done:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > networkMaxBackoff {
+				backoff = networkMaxBackoff
+			}
+		}
+		backoff = networkMinBackoff
+
+		writer.mutex.Lock()
+		writer.sending = false
+		writer.mutex.Unlock()
+	}
+}
+
+// send writes line to the connection, dialing it first if needed, and
+// reports whether it succeeded.
+func (writer *networkWriter) send(line []byte) bool {
+	if writer.conn == nil {
+		conn, err := writer.dial()
+		if err != nil {
+			return false
+		}
+		writer.conn = conn
+	}
+
+	writer.conn.SetWriteDeadline(time.Now().Add(networkWriteTimeout))
+	if _, err := writer.conn.Write(line); err != nil {
+		writer.conn.Close()
+		writer.conn = nil
+		return false
+	}
+	return true
+}
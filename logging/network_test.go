@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetNetworkOutput(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	assert.Error(t, SetNetworkOutput("tcp", "127.0.0.1:1"))
+
+	assert.NoError(t, SetNetworkOutput("tcp", listener.Addr().String()))
+	defer resetOutput()
+	defer networkOutput.Close()
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	Info().Log("over the network")
+	Error().Log("also over the network")
+	assert.NoError(t, Flush())
+
+	lines := bufio.NewScanner(conn)
+	assert.True(t, lines.Scan())
+	assert.Contains(t, lines.Text(), `"msg":"over the network"`)
+	assert.True(t, lines.Scan())
+	assert.Contains(t, lines.Text(), `"msg":"also over the network"`)
+}
+
+func TestNetworkWriterReconnects(t *testing.T) {
+	var dials int32
+	server, client := net.Pipe()
+	defer server.Close()
+	writer := newNetworkWriter(func() (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return client, nil
+	})
+	defer writer.Close()
+
+	for i := 0; i < maxNetworkPending+5; i++ {
+		writer.Write([]byte(Int(i) + "\n"))
+	}
+	assert.Len(t, writer.pending, maxNetworkPending)
+
+	go writer.run()
+	lines := bufio.NewScanner(server)
+	assert.True(t, lines.Scan())
+	assert.Equal(t, "5", lines.Text())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&dials))
+
+	for i := 6; i < maxNetworkPending+5; i++ {
+		assert.True(t, lines.Scan())
+	}
+	assert.Equal(t, Int(maxNetworkPending+4), lines.Text())
+	assert.NoError(t, writer.Flush())
+}
+
+func TestNetworkWriterFlushAfterClose(t *testing.T) {
+	writer := newNetworkWriter(func() (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+	writer.Write([]byte("first\n"))
+	writer.Write([]byte("second\n"))
+	go writer.run()
+
+	// Wait for run to be retrying the first line.
+	for {
+		writer.mutex.Lock()
+		sending := writer.sending
+		writer.mutex.Unlock()
+		if sending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	writer.Close()
+
+	// Flush doesn't wait for lines that will never be sent, including the
+	// one that was being sent.
+	start := time.Now()
+	err := writer.Flush()
+	if assert.Error(t, err) {
+		assert.Equal(t, "1 log lines not sent before the output was closed", err.Error())
+	}
+	assert.Less(t, time.Since(start), networkFlushTimeout)
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	assert.False(t, writer.sending)
+	assert.True(t, writer.stopped)
+}
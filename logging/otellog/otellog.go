@@ -0,0 +1,33 @@
+// Package otellog links log lines to OpenTelemetry traces.
+package otellog
+
+import (
+	"context"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceIDKey is the arg name of the trace ID.
+	TraceIDKey = "trace_id"
+
+	// SpanIDKey is the arg name of the span ID.
+	SpanIDKey = "span_id"
+)
+
+// ContextWithTraceFields returns a copy of ctx whose logging fields include
+// the trace and span IDs of the span carried by ctx, so loggers bound to it
+// with logging.FromContext or Logger.WithContext emit them on every line.
+// If ctx carries no valid span it is returned unchanged.
+func ContextWithTraceFields(ctx context.Context) context.Context {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ctx
+	}
+
+	return logging.ContextWithFields(ctx, logging.Args{
+		TraceIDKey: spanContext.TraceID().String(),
+		SpanIDKey:  spanContext.SpanID().String(),
+	})
+}
@@ -0,0 +1,43 @@
+package otellog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestContextWithTraceFields(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer func() {
+		logging.SetOutput(os.Stdout)
+		logging.SetLevelOutput("error", os.Stderr)
+		logging.SetLevelOutput("fatal", os.Stderr)
+	}()
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01, 0x02},
+		SpanID:  trace.SpanID{0x03},
+	})
+	traced := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	logging.FromContext(ContextWithTraceFields(traced)).Log("traced")
+	logging.FromContext(ContextWithTraceFields(context.Background())).Log("untraced")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	entry := map[string]string{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "01020000000000000000000000000000", entry["arg_trace_id"])
+	assert.Equal(t, "0300000000000000", entry["arg_span_id"])
+
+	assert.NotContains(t, lines[1], "trace_id")
+	assert.NotContains(t, lines[1], "span_id")
+}
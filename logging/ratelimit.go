@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitReportInterval is the minimum time between the lines reporting
+// how many lines the rate limit dropped.
+const rateLimitReportInterval = time.Second
+
+// rateLimitedMsg is the msg of the lines reporting dropped lines.
+const rateLimitedMsg = "log lines dropped by the rate limit"
+
+// rateLimiter is a token bucket holding up to one second's worth of lines.
+type rateLimiter struct {
+	mutex sync.Mutex
+
+	perSecond float64
+	tokens    float64
+	refilled  time.Time
+
+	// dropped is the number of lines dropped since the last report.
+	dropped    uint64
+	lastReport time.Time
+
+	// stop ends reportPeriodically once the limiter is replaced.
+	stop chan struct{}
+}
+
+// SetRateLimit drops the lines that exceed a budget of perSecond lines per
+// second, allowing bursts of up to perSecond lines. At most once a second, a
+// warn line with the number of lines dropped since the previous one in the
+// "rateLimited" field is written, before the next line within the budget or,
+// if nothing else is logged, on its own once the second is up. Fatal lines
+// are never dropped. A perSecond of 0 or less disables the limit, which is
+// the default.
+func SetRateLimit(perSecond int) {
+	var limiter *rateLimiter
+	if perSecond > 0 {
+		limiter = &rateLimiter{
+			perSecond: float64(perSecond),
+			tokens:    float64(perSecond),
+			refilled:  time.Now(),
+			stop:      make(chan struct{}),
+		}
+		go limiter.reportPeriodically()
+	}
+
+	var previous *rateLimiter
+	updateOptions(func(opts *options) {
+		previous = opts.rateLimiter
+		opts.rateLimiter = limiter
+	})
+	if previous != nil {
+		close(previous.stop)
+	}
+}
+
+// reportPeriodically reports the dropped lines that are due every
+// rateLimitReportInterval, so that they are reported even if no line is
+// logged after them, until the limiter is stopped.
+func (limiter *rateLimiter) reportPeriodically() {
+	ticker := time.NewTicker(rateLimitReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-limiter.stop:
+			return
+		case now := <-ticker.C:
+			limiter.mutex.Lock()
+			report := limiter.takeReport(now)
+			limiter.mutex.Unlock()
+
+			if report > 0 {
+				reportRateLimited(report, 0)
+			}
+		}
+	}
+}
+
+// reportRateLimited writes the warn line reporting report dropped lines.
+func reportRateLimited(report uint64, stackDepth int) {
+	reporter := &Logger{Level: "warn", rateLimited: report}
+	reporter.logGeneric(rateLimitedMsg, msgPlain, nil, nil, nil, stackDepth+1)
+}
+
+// allow reports whether a line logged at now is within the budget and, if
+// so, the number of dropped lines that are due to be reported.
+func (limiter *rateLimiter) allow(now time.Time) (ok bool, report uint64) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.tokens += now.Sub(limiter.refilled).Seconds() * limiter.perSecond
+	if limiter.tokens > limiter.perSecond {
+		limiter.tokens = limiter.perSecond
+	}
+	limiter.refilled = now
+
+	if limiter.tokens < 1 {
+		limiter.dropped++
+		return false, 0
+	}
+	limiter.tokens--
+	return true, limiter.takeReport(now)
+}
+
+// takeReport returns the number of dropped lines due to be reported at now,
+// if any, resetting it. The mutex must be held.
+func (limiter *rateLimiter) takeReport(now time.Time) (report uint64) {
+	if limiter.dropped > 0 && now.Sub(limiter.lastReport) >= rateLimitReportInterval {
+		report, limiter.dropped = limiter.dropped, 0
+		limiter.lastReport = now
+	}
+	return report
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRateLimit(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+	SetRateLimit(5)
+	defer SetRateLimit(0)
+
+	for i := 0; i < 20; i++ {
+		Info().Log("burst")
+	}
+	assert.Equal(t, 5, strings.Count(buf.String(), "\n"))
+
+	// Pretend a second and a half has passed.
+	limiter := loadOptions().rateLimiter
+	limiter.mutex.Lock()
+	limiter.refilled = limiter.refilled.Add(-1500 * time.Millisecond)
+	limiter.lastReport = limiter.lastReport.Add(-1500 * time.Millisecond)
+	limiter.mutex.Unlock()
+
+	buf.Reset()
+	for i := 0; i < 20; i++ {
+		Info().Log("burst")
+	}
+	assert.Panics(t, func() { Fatal().Log("never limited") })
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if assert.Len(t, lines, 7) {
+		report := map[string]string{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &report))
+		assert.Equal(t, "warn", report["level"])
+		assert.Equal(t, rateLimitedMsg, report["msg"])
+		assert.Equal(t, "15", report["rateLimited"])
+		assert.Contains(t, lines[6], "never limited")
+	}
+}
+
+func TestRateLimiterReportsAtMostOncePerInterval(t *testing.T) {
+	start := time.Now()
+	limiter := &rateLimiter{perSecond: 1, tokens: 1, refilled: start, lastReport: start}
+
+	ok, _ := limiter.allow(start)
+	assert.True(t, ok)
+	ok, _ = limiter.allow(start)
+	assert.False(t, ok)
+
+	ok, report := limiter.allow(start.Add(time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), report)
+
+	limiter.allow(start.Add(time.Second))
+	ok, report = limiter.allow(start.Add(1500 * time.Millisecond))
+	assert.False(t, ok)
+	ok, report = limiter.allow(start.Add(2 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), report)
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (buffer *lockedBuffer) Write(p []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buf.Write(p)
+}
+
+func (buffer *lockedBuffer) String() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buf.String()
+}
+
+func TestRateLimitReportsWhenQuiet(t *testing.T) {
+	buf := &lockedBuffer{}
+	SetOutput(buf)
+	defer resetOutput()
+	SetRateLimit(2)
+	defer SetRateLimit(0)
+
+	for i := 0; i < 5; i++ {
+		Info().Log("burst")
+	}
+
+	// Nothing else is logged, but the dropped lines are reported anyway.
+	deadline := time.Now().Add(3 * rateLimitReportInterval)
+	for !strings.Contains(buf.String(), rateLimitedMsg) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if assert.Len(t, lines, 3) {
+		report := map[string]string{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[2]), &report))
+		assert.Equal(t, "warn", report["level"])
+		assert.Equal(t, rateLimitedMsg, report["msg"])
+		assert.Equal(t, "3", report["rateLimited"])
+		assert.Equal(t, "reportPeriodically()", report["func"])
+	}
+
+	// Once reported, the drops aren't reported again.
+	time.Sleep(rateLimitReportInterval + 100*time.Millisecond)
+	assert.Equal(t, 1, strings.Count(buf.String(), `"rateLimited":`))
+}
+
+func TestSetRateLimitStopsPreviousReports(t *testing.T) {
+	SetRateLimit(1)
+	previous := loadOptions().rateLimiter
+	SetRateLimit(0)
+
+	select {
+	case <-previous.stop:
+	default:
+		t.Error("the replaced limiter wasn't stopped")
+	}
+}
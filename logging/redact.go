@@ -0,0 +1,59 @@
+package logging
+
+import "regexp"
+
+// Redacted replaces redacted values in log lines.
+const Redacted = "[REDACTED]"
+
+// RegisterRedactedKey makes the value of any arg named key, without the
+// "arg_" prefix, appear as Redacted in every subsequent log line, including
+// in messages rendered from a template.
+func RegisterRedactedKey(key string) {
+	updateOptions(func(opts *options) {
+		redactedKeys := make(map[string]bool, len(opts.redactedKeys)+1)
+		for k := range opts.redactedKeys {
+			redactedKeys[k] = true
+		}
+		redactedKeys[key] = true
+		opts.redactedKeys = redactedKeys
+	})
+}
+
+// RegisterRedactedPattern replaces every match of pattern with Redacted in
+// the message, the error and the string arg values of every subsequent log
+// line, e.g. to catch bearer tokens in request dumps.
+func RegisterRedactedPattern(pattern *regexp.Regexp) {
+	updateOptions(func(opts *options) {
+		patterns := make([]*regexp.Regexp, len(opts.redactedPatterns), len(opts.redactedPatterns)+1)
+		copy(patterns, opts.redactedPatterns)
+		opts.redactedPatterns = append(patterns, pattern)
+	})
+}
+
+// redactString applies the registered patterns to s.
+func (opts *options) redactString(s string) string {
+	for _, pattern := range opts.redactedPatterns {
+		s = pattern.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// redactFields returns fields with redacted values replaced. Fields is
+// returned as-is when nothing needs replacing, and is never modified.
+func (opts *options) redactFields(fields Fields) Fields {
+	if len(fields) == 0 || (len(opts.redactedKeys) == 0 && len(opts.redactedPatterns) == 0) {
+		return fields
+	}
+
+	redacted := make(Fields, len(fields))
+	for k, v := range fields {
+		if opts.redactedKeys[k] {
+			redacted[k] = Redacted
+		} else if s, ok := v.(string); ok {
+			redacted[k] = opts.redactString(s)
+		} else {
+			redacted[k] = v
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+	defer updateOptions(func(opts *options) {
+		opts.redactedKeys = nil
+		opts.redactedPatterns = nil
+	})
+
+	RegisterRedactedKey("api_token")
+	RegisterRedactedPattern(regexp.MustCompile(`Bearer [A-Za-z0-9._-]+`))
+
+	args := Args{"api_token": "secret", "header": "Authorization: Bearer abc.def", "project": "123"}
+	Info().LogArgs("token {{.api_token}} for {{.project}}", args)
+	Warn().LogErr("request failed", errors.New("sent Bearer abc.def"))
+	Debug().Log("dump: Bearer xyz")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.NotContains(t, buf.String(), "secret")
+	assert.NotContains(t, buf.String(), "abc.def")
+	assert.NotContains(t, buf.String(), "xyz")
+	assert.Equal(t, "secret", args["api_token"])
+
+	entry := map[string]string{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "token [REDACTED] for 123", entry["msg"])
+	assert.Equal(t, "[REDACTED]", entry["arg_api_token"])
+	assert.Equal(t, "Authorization: [REDACTED]", entry["arg_header"])
+	assert.Equal(t, "123", entry["arg_project"])
+
+	assert.Contains(t, lines[1], `"error":"sent [REDACTED]"`)
+	assert.Contains(t, lines[2], `"msg":"dump: [REDACTED]"`)
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// maxSampledTemplates caps the number of msgTemplates with their own
+// sampling counter. Lines with other msgTemplates share one counter per
+// level.
+const maxSampledTemplates = 1024
+
+var (
+	// samplers maps samplerKey to the *sampler of each sampled msgTemplate.
+	samplers sync.Map
+
+	// samplersSize counts the entries in samplers.
+	samplersSize int32
+)
+
+// samplerKey identifies the lines counted by a sampler. An empty msgTemplate
+// is the shared counter of a level.
+type samplerKey struct {
+	level       string
+	msgTemplate string
+}
+
+// sampler counts the lines logged with one msgTemplate at one level.
+type sampler struct {
+	// count is the number of lines seen.
+	count uint64
+
+	// dropped is the number of lines dropped since the last one written.
+	dropped uint64
+}
+
+// SetSampling writes only every everyN-th line of the given level, counting
+// the lines with each msgTemplate separately, so that a tight loop can't
+// flood the log. The first line of every run of everyN is written, with the
+// number of lines dropped before it in the "sampledDropped" field. An everyN
+// of 1 or less disables sampling for the level, which is the default.
+//
+// Error lines are only sampled if enabled explicitly with this function,
+// and fatal lines can't be sampled.
+func SetSampling(level string, everyN int) error {
+	if _, ok := levelRanks[level]; !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	if level == "fatal" {
+		return fmt.Errorf("fatal log lines can't be sampled")
+	}
+
+	updateOptions(func(opts *options) {
+		sampling := make(map[string]uint64, len(opts.sampling)+1)
+		for k, v := range opts.sampling {
+			sampling[k] = v
+		}
+		if everyN > 1 {
+			sampling[level] = uint64(everyN)
+		} else {
+			delete(sampling, level)
+		}
+		opts.sampling = sampling
+	})
+	return nil
+}
+
+// sample reports whether a line should be written and, if so, how many lines
+// with the same level and msgTemplate were dropped before it.
+func (opts *options) sample(level, msgTemplate string) (write bool, dropped uint64) {
+	everyN, ok := opts.sampling[level]
+	if !ok {
+		return true, 0
+	}
+
+	s := samplerFor(samplerKey{level, msgTemplate})
+	if (atomic.AddUint64(&s.count, 1)-1)%everyN != 0 {
+		atomic.AddUint64(&s.dropped, 1)
+		return false, 0
+	}
+	return true, atomic.SwapUint64(&s.dropped, 0)
+}
+
+// samplerFor returns the sampler for key, falling back to the level's shared
+// sampler once maxSampledTemplates is reached.
+func samplerFor(key samplerKey) *sampler {
+	if s, ok := samplers.Load(key); ok {
+		return s.(*sampler)
+	}
+
+	if atomic.LoadInt32(&samplersSize) >= maxSampledTemplates {
+		key.msgTemplate = ""
+	}
+	s, loaded := samplers.LoadOrStore(key, &sampler{})
+	if !loaded {
+		atomic.AddInt32(&samplersSize, 1)
+	}
+	return s.(*sampler)
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSampling(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+	assert.NoError(t, SetSampling("debug", 3))
+	defer SetSampling("debug", 0)
+
+	for i := 0; i < 7; i++ {
+		Debug().LogArgs("retrying {{.attempt}}", Args{"attempt": Int(i)})
+		Debug().Log("polling")
+		Info().Log("not sampled")
+	}
+
+	var attempts, polls, infos []map[string]string
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		entry := map[string]string{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		switch entry["msgTemplate"] {
+		case "retrying {{.attempt}}":
+			attempts = append(attempts, entry)
+		case "polling":
+			polls = append(polls, entry)
+		default:
+			infos = append(infos, entry)
+		}
+	}
+
+	assert.Len(t, infos, 7)
+	assert.Len(t, polls, 3)
+	if assert.Len(t, attempts, 3) {
+		assert.Equal(t, "retrying 0", attempts[0]["msg"])
+		assert.NotContains(t, attempts[0], "sampledDropped")
+		assert.Equal(t, "retrying 3", attempts[1]["msg"])
+		assert.Equal(t, "2", attempts[1]["sampledDropped"])
+		assert.Equal(t, "retrying 6", attempts[2]["msg"])
+		assert.Equal(t, "2", attempts[2]["sampledDropped"])
+	}
+
+	assert.Error(t, SetSampling("fatal", 10))
+	assert.Error(t, SetSampling("verbose", 10))
+}
+
+func TestSetSamplingConcurrent(t *testing.T) {
+	var lines int64
+	SetOutput(ioutil.Discard)
+	defer resetOutput()
+	SetMetricsHook(func(string) { atomic.AddInt64(&lines, 1) })
+	defer SetMetricsHook(nil)
+	assert.NoError(t, SetSampling("warn", 10))
+	defer SetSampling("warn", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Warn().Log("concurrently sampled")
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(100), atomic.LoadInt64(&lines))
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// slogHandler is a slog.Handler that writes through this package, so records
+// logged with log/slog keep the same JSON shape as every other line.
+type slogHandler struct {
+	// fields holds the attributes added with WithAttrs, already prefixed.
+	fields Fields
+
+	// prefix is the dot-joined group names opened with WithGroup, followed
+	// by a dot, or "" outside of any group.
+	prefix string
+}
+
+// NewSlogHandler returns a slog.Handler that writes records as log lines of
+// the matching level, with attributes as "arg_" fields. Group names are
+// dot-joined into the keys of the attributes they contain. Records above
+// slog.LevelError are written at fatal level, but never terminate the
+// process.
+func NewSlogHandler() slog.Handler {
+	return &slogHandler{}
+}
+
+// slogLevel maps a slog level to the name of the matching level.
+func slogLevel(level slog.Level) string {
+	switch {
+	case level < slog.LevelDebug:
+		return "trace"
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < slog.LevelWarn:
+		return "info"
+	case level < slog.LevelError:
+		return "warn"
+	case level == slog.LevelError:
+		return "error"
+	default:
+		return "fatal"
+	}
+}
+
+func (handler *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return IsEnabled(slogLevel(level))
+}
+
+func (handler *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make(Fields, len(handler.fields)+record.NumAttrs())
+	for k, v := range handler.fields {
+		fields[k] = v
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(fields, handler.prefix, attr)
+		return true
+	})
+
+	logger := &Logger{Level: slogLevel(record.Level), ctx: ctx, callerPC: record.PC}
+	logger.logGeneric(record.Message, msgPlain, nil, nil, fields, 1)
+	return nil
+}
+
+func (handler *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(Fields, len(handler.fields)+len(attrs))
+	for k, v := range handler.fields {
+		fields[k] = v
+	}
+	for _, attr := range attrs {
+		addSlogAttr(fields, handler.prefix, attr)
+	}
+	return &slogHandler{fields: fields, prefix: handler.prefix}
+}
+
+func (handler *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return handler
+	}
+	return &slogHandler{fields: handler.fields, prefix: handler.prefix + name + "."}
+}
+
+// addSlogAttr adds attr to fields under prefix, flattening groups.
+func addSlogAttr(fields Fields, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, groupAttr := range value.Group() {
+			addSlogAttr(fields, groupPrefix, groupAttr)
+		}
+		return
+	}
+
+	if attr.Key == "" {
+		return
+	}
+	fields[prefix+attr.Key] = slogValue(value)
+}
+
+// slogValue converts a resolved, non-group slog value to a JSON-encodable
+// value.
+func slogValue(value slog.Value) interface{} {
+	switch value.Kind() {
+	case slog.KindString:
+		return value.String()
+	case slog.KindInt64:
+		return value.Int64()
+	case slog.KindUint64:
+		return value.Uint64()
+	case slog.KindFloat64:
+		return value.Float64()
+	case slog.KindBool:
+		return value.Bool()
+	case slog.KindDuration:
+		return Duration(value.Duration())
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	}
+
+	if err, ok := value.Any().(error); ok {
+		return err.Error()
+	}
+	return value.Any()
+}
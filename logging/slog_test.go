@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+
+	logger := slog.New(NewSlogHandler()).With("project_id", "123").WithGroup("event")
+	logger.Warn("event {{not a template}}", "name", "project.imported", "keys", 42,
+		slog.Group("file", "format", "json"), "err", errors.New("boom"))
+	logger.Debug("debug")
+	logger.Log(context.Background(), slog.LevelError+4, "critical")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "event {{not a template}}", entry["msg"])
+	assert.Equal(t, "123", entry["arg_project_id"])
+	assert.Equal(t, "project.imported", entry["arg_event.name"])
+	assert.Equal(t, float64(42), entry["arg_event.keys"])
+	assert.Equal(t, "json", entry["arg_event.file.format"])
+	assert.Equal(t, "boom", entry["arg_event.err"])
+	assert.Equal(t, "slog_test.go", entry["file"])
+	assert.Equal(t, "TestSlogHandler()", entry["func"])
+
+	assert.Contains(t, lines[1], `"level":"debug"`)
+	assert.Contains(t, lines[2], `"level":"fatal"`)
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// stdLogCallerDepth is the distance from stdLogWriter.Write to the code that
+// called into the standard library logger, e.g. log.Printf -> output -> Write.
+const stdLogCallerDepth = 3
+
+// stdLogWriter turns each line written to it into a log line.
+type stdLogWriter struct {
+	logger *Logger
+
+	mutex   sync.Mutex
+	pending []byte
+}
+
+// StdLogWriter returns an io.Writer that writes each line written to it as a
+// log line of the given level, so output of the standard library log package
+// can be captured with
+//
+//	log.SetFlags(0)
+//	log.SetOutput(logging.StdLogWriter("info"))
+//
+// Text not yet terminated by a newline is held back until the rest of the
+// line arrives. Lines written at fatal level never terminate the process;
+// log.Fatal already does that.
+func StdLogWriter(level string) io.Writer {
+	return &stdLogWriter{logger: &Logger{Level: level}}
+}
+
+func (writer *stdLogWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.pending = append(writer.pending, p...)
+	for {
+		i := bytes.IndexByte(writer.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		writer.logger.logGeneric(string(writer.pending[:i]), msgPlain, nil, nil, nil, stdLogCallerDepth)
+		writer.pending = writer.pending[i+1:]
+	}
+
+	if len(writer.pending) == 0 {
+		writer.pending = nil
+	}
+	return len(p), nil
+}
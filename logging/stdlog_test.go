@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+
+	stdLogger := log.New(StdLogWriter("warn"), "", 0)
+	_, _, line, _ := runtime.Caller(0)
+	stdLogger.Printf("first\nsecond")
+
+	writer := StdLogWriter("info")
+	written := buf.Len()
+	writer.Write([]byte("par"))
+	assert.Equal(t, written, buf.Len())
+	writer.Write([]byte("tial\nnext\n"))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 4)
+
+	entries := make([]map[string]string, len(lines))
+	for i, l := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(l), &entries[i]))
+	}
+
+	assert.Equal(t, "first", entries[0]["msg"])
+	assert.Equal(t, "warn", entries[0]["level"])
+	assert.Equal(t, Int(line+1), entries[0]["line"])
+	assert.Equal(t, "second", entries[1]["msg"])
+	assert.Equal(t, "partial", entries[2]["msg"])
+	assert.Equal(t, "info", entries[2]["level"])
+	assert.Equal(t, "next", entries[3]["msg"])
+}
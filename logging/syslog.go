@@ -0,0 +1,57 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log/syslog"
+)
+
+// SetSyslogOutput redirects all subsequent log lines to the local syslog
+// daemon, with the facility of priority, e.g. int(syslog.LOG_LOCAL0), and
+// the given tag. Each line is sent unchanged as the message, so it can
+// still be parsed downstream, with a severity that depends on its level:
+// trace and debug are sent as LOG_DEBUG, info as LOG_INFO, warn as
+// LOG_WARNING, error as LOG_ERR and fatal as LOG_CRIT. Syslog isn't
+// available on Windows and Plan 9, where an error is returned instead.
+func SetSyslogOutput(priority int, tag string) error {
+	writer, err := syslog.New(syslog.Priority(priority), tag)
+	if err != nil {
+		return fmt.Errorf("connecting to syslog: %w", err)
+	}
+
+	setSyslogWriter(writer)
+	return nil
+}
+
+// syslogSeverities maps levels to the syslog.Writer method that sends a
+// message with the matching severity.
+var syslogSeverities = map[string]func(*syslog.Writer, string) error{
+	"trace": (*syslog.Writer).Debug,
+	"debug": (*syslog.Writer).Debug,
+	"info":  (*syslog.Writer).Info,
+	"warn":  (*syslog.Writer).Warning,
+	"error": (*syslog.Writer).Err,
+	"fatal": (*syslog.Writer).Crit,
+}
+
+func setSyslogWriter(writer *syslog.Writer) {
+	for _, level := range levels {
+		SetLevelOutput(level, syslogLevelWriter{writer, syslogSeverities[level]})
+	}
+}
+
+// syslogLevelWriter sends each line written to it with one severity.
+type syslogLevelWriter struct {
+	writer *syslog.Writer
+	send   func(*syslog.Writer, string) error
+}
+
+// Write implements io.Writer.
+func (w syslogLevelWriter) Write(p []byte) (int, error) {
+	if err := w.send(w.writer, string(bytes.TrimSuffix(p, []byte("\n")))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
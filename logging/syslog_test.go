@@ -0,0 +1,49 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"log/syslog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogOutput(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Close()
+
+	writer, err := syslog.Dial("udp", server.LocalAddr().String(), syslog.LOG_LOCAL0, "listener")
+	assert.NoError(t, err)
+	defer writer.Close()
+	setSyslogWriter(writer)
+	defer resetOutput()
+
+	read := func() string {
+		packet := make([]byte, 4096)
+		n, _, err := server.ReadFrom(packet)
+		assert.NoError(t, err)
+		return string(packet[:n])
+	}
+
+	// LOG_LOCAL0 is facility 16, so priorities start at 16*8.
+	priorities := map[string]string{
+		"trace": "<135>",
+		"debug": "<135>",
+		"info":  "<134>",
+		"warn":  "<132>",
+		"error": "<131>",
+	}
+	for level, priority := range priorities {
+		(&Logger{Level: level}).Log("via syslog")
+		message := read()
+		assert.True(t, strings.HasPrefix(message, priority), message)
+		assert.Contains(t, message, "listener[")
+		assert.Contains(t, message, `{"time":`)
+		assert.Contains(t, message, `"msg":"via syslog"`)
+		assert.True(t, strings.HasSuffix(message, "}\n"), message)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package logging
+
+import "errors"
+
+// SetSyslogOutput would redirect log lines to syslog, which isn't available
+// on this platform, so it always returns an error.
+func SetSyslogOutput(priority int, tag string) error {
+	return errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"text/template/parse"
+)
+
+// maxCachedTemplates caps the number of parsed templates kept in
+// templateCache, so that logging an unbounded number of distinct templates,
+// e.g. ones built from request data, can't grow memory without bound.
+// Templates beyond the cap are parsed on every call.
+const maxCachedTemplates = 1024
+
+var (
+	// templateCache maps templateKey to the parsed *template.Template.
+	// Parsed templates are safe for concurrent execution.
+	templateCache sync.Map
+
+	// templateCacheSize counts the entries in templateCache.
+	templateCacheSize int32
+)
+
+// templateKey identifies a parsed template. The option is part of the key
+// since it is applied when the template is created.
+type templateKey struct {
+	option string
+	text   string
+}
+
+// SetTemplateOption sets an option, in the form accepted by
+// template.Template.Option, on the templates used to render messages. The
+// default is "missingkey=default", which renders missing args as "<no value>".
+//
+// With "missingkey=error", lines whose template refers to args that weren't
+// supplied are still written, with the missing args rendered empty, and the
+// names of the missing args are recorded in the "arg__missingKeys" field.
+func SetTemplateOption(option string) (err error) {
+	defer func() {
+		// Option panics on options it doesn't recognize.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("logging: invalid template option %q: %v", option, r)
+		}
+	}()
+	template.New("").Option(option)
+
+	updateOptions(func(opts *options) {
+		opts.templateOption = option
+	})
+	return nil
+}
+
+// renderTemplate executes msgTemplate against fields. When the template
+// option makes missing args an error, the names of the missing args are
+// returned and the message is rendered with them left empty.
+func (opts *options) renderTemplate(msgTemplate string, fields Fields) (msg string, missingKeys []string, err error) {
+	t, err := opts.parseTemplate(msgTemplate)
+	if err != nil {
+		return "", nil, err
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err = t.Execute(buf, fields); err == nil {
+		return buf.String(), nil, nil
+	}
+
+	missingKeys = findMissingKeys(t.Tree.Root, fields, nil)
+	if len(missingKeys) == 0 {
+		return "", nil, err
+	}
+	sort.Strings(missingKeys)
+
+	// missingkey=zero would still render "<no value>" for interface values.
+	blanks := make(Fields, len(missingKeys))
+	for _, key := range missingKeys {
+		blanks[key] = ""
+	}
+	buf.Reset()
+	if err = t.Execute(buf, mergeFields(fields, blanks)); err != nil {
+		return "", missingKeys, err
+	}
+	return buf.String(), missingKeys, nil
+}
+
+// parseTemplate returns msgTemplate parsed with the template option, reusing
+// the cached template when there is one.
+func (opts *options) parseTemplate(msgTemplate string) (*template.Template, error) {
+	key := templateKey{opts.templateOption, msgTemplate}
+	if cached, ok := templateCache.Load(key); ok {
+		return cached.(*template.Template), nil
+	}
+
+	t := template.New("")
+	if opts.templateOption != "" {
+		t.Option(opts.templateOption)
+	}
+	t, err := t.Parse(msgTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	if atomic.LoadInt32(&templateCacheSize) < maxCachedTemplates {
+		if _, loaded := templateCache.LoadOrStore(key, t); !loaded {
+			atomic.AddInt32(&templateCacheSize, 1)
+		}
+	}
+	return t, nil
+}
+
+// findMissingKeys appends to missing the names of the top-level fields
+// referred to by node that aren't in fields. The bodies of range and with
+// actions are skipped, since dot no longer refers to fields inside them.
+func findMissingKeys(node parse.Node, fields Fields, missing []string) []string {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return missing
+		}
+		for _, child := range node.Nodes {
+			missing = findMissingKeys(child, fields, missing)
+		}
+	case *parse.ActionNode:
+		missing = findMissingKeys(node.Pipe, fields, missing)
+	case *parse.IfNode:
+		missing = findMissingKeys(node.Pipe, fields, missing)
+		missing = findMissingKeys(node.List, fields, missing)
+		missing = findMissingKeys(node.ElseList, fields, missing)
+	case *parse.RangeNode:
+		missing = findMissingKeys(node.Pipe, fields, missing)
+	case *parse.WithNode:
+		missing = findMissingKeys(node.Pipe, fields, missing)
+	case *parse.PipeNode:
+		if node == nil {
+			return missing
+		}
+		for _, cmd := range node.Cmds {
+			for _, arg := range cmd.Args {
+				missing = findMissingKeys(arg, fields, missing)
+			}
+		}
+	case *parse.FieldNode:
+		key := node.Ident[0]
+		if _, ok := fields[key]; !ok && !containsString(missing, key) {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateMissingKeys(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+	defer updateOptions(func(opts *options) {
+		opts.templateOption = ""
+	})
+
+	Info().LogArgs("hello {{.name}}", Args{})
+
+	assert.NoError(t, SetTemplateOption("missingkey=error"))
+	Info().LogArgs("hello {{.name}} from {{.place}}{{if .name}}!{{end}}", Args{"place": "Riga"})
+	Info().LogFields("{{range .items}}{{.id}}{{end}} items", Fields{"items": []map[string]string{{"id": "a"}}})
+	Info().LogArgs("{{.name | printf \"%q\"}}", Args{"name": "x"})
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	entries := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+	}
+
+	assert.Equal(t, "hello <no value>", entries[0]["msg"])
+	assert.NotContains(t, entries[0], "arg__missingKeys")
+
+	assert.Equal(t, "hello  from Riga", entries[1]["msg"])
+	assert.Equal(t, []interface{}{"name"}, entries[1]["arg__missingKeys"])
+	assert.NotContains(t, entries[1], "arg__templateErr")
+
+	assert.Equal(t, "a items", entries[2]["msg"])
+	assert.NotContains(t, entries[2], "arg__missingKeys")
+
+	assert.Equal(t, `"x"`, entries[3]["msg"])
+
+	assert.Error(t, SetTemplateOption("missingkey=sometimes"))
+	assert.Equal(t, "missingkey=error", loadOptions().templateOption)
+}
+
+// resetTemplateCache empties the parsed template cache.
+func resetTemplateCache() {
+	templateCache.Range(func(key, _ interface{}) bool {
+		templateCache.Delete(key)
+		return true
+	})
+	atomic.StoreInt32(&templateCacheSize, 0)
+}
+
+func TestTemplateCache(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer resetOutput()
+	resetTemplateCache()
+	defer resetTemplateCache()
+
+	Info().LogArgs("exported {{.key_count}} keys", Args{"key_count": "1"})
+	Info().LogArgs("exported {{.key_count}} keys", Args{"key_count": "2"})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&templateCacheSize))
+	assert.Contains(t, buf.String(), `"msg":"exported 2 keys"`)
+
+	// Invalid templates aren't cached.
+	Info().LogArgs("{{.broken", Args{})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&templateCacheSize))
+
+	for i := 0; i < maxCachedTemplates+10; i++ {
+		Info().LogArgs(fmt.Sprintf("template %d {{.n}}", i), Args{"n": "1"})
+	}
+	assert.Equal(t, int32(maxCachedTemplates), atomic.LoadInt32(&templateCacheSize))
+
+	buf.Reset()
+	Info().LogArgs("template 1030 {{.n}}", Args{"n": "2"})
+	assert.Contains(t, buf.String(), `"msg":"template 1030 2"`)
+}
@@ -0,0 +1,169 @@
+package lokalise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+const (
+	// exportTimeout bounds the time spent waiting for an export to finish.
+	exportTimeout = 5 * time.Minute
+
+	exportMinPollDelay = time.Second
+	exportMaxPollDelay = 15 * time.Second
+)
+
+// ExportOptions are the export settings of a bundle downloaded with
+// DownloadBundle. Format is required, e.g. "json" or "strings". The filters
+// are left out of the export request when empty.
+type ExportOptions struct {
+	Format            string   `json:"format"`
+	Languages         []string `json:"filter_langs,omitempty"`
+	Filenames         []string `json:"filter_filenames,omitempty"`
+	FilterData        []string `json:"filter_data,omitempty"`
+	IncludeTags       []string `json:"include_tags,omitempty"`
+	ExcludeTags       []string `json:"exclude_tags,omitempty"`
+	OriginalFilenames bool     `json:"original_filenames"`
+}
+
+// exportProcess is the state of an asynchronous export.
+type exportProcess struct {
+	ProcessID string `json:"process_id"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	Details   struct {
+		DownloadURL string `json:"download_url"`
+	} `json:"details"`
+}
+
+// DownloadBundle exports the translations of a project with the given
+// settings and returns the zip archive Lokalise produces. The export runs
+// asynchronously in Lokalise, so it is polled, backing off, until it
+// finishes. If the archive has the same ETag, recorded in BundleETags, as
+// the last one downloaded for the project and format, ErrBundleUnchanged is
+// returned instead. Lokalise only reports the ETag once the export is done,
+// so an unchanged bundle still costs the export's API calls, and only its
+// download is saved. The export is abandoned when ctx is cancelled.
+func DownloadBundle(ctx context.Context, projectID string, opts ExportOptions) ([]byte, error) {
+	if len(opts.Format) == 0 {
+		return nil, utils.WrapError(errors.New("no export format given"))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	args := logging.Args{
+		"project_id": projectID,
+		"format":     opts.Format,
+	}
+
+	projectPath := lokaliseProjectsAPI + "/" + projectID
+	started := struct {
+		ProcessID string `json:"process_id"`
+	}{}
+	if err := callLokaliseAPI(ctx, http.MethodPost, projectPath+"/files/async-download", opts, &started); err != nil {
+		return nil, utils.WrapError(err)
+	}
+
+	args["process_id"] = started.ProcessID
+	logging.Debug().LogArgs("started export {{.process_id}} of project {{.project_id}}", args)
+
+	process, err := waitForExport(ctx, projectPath+"/processes/"+started.ProcessID, args)
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+
+	bundle, err := downloadExport(ctx, process.Details.DownloadURL, projectID+"/"+opts.Format)
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+
+	args["size"] = logging.Int(len(bundle))
+	logging.Debug().LogArgs("downloaded export {{.process_id}} of project {{.project_id}}", args)
+	return bundle, nil
+}
+
+// waitForExport polls the export process at path until it finishes.
+func waitForExport(ctx context.Context, path string, args logging.Args) (*exportProcess, error) {
+	delay := exportMinPollDelay
+	for {
+		result := struct {
+			Process exportProcess `json:"process"`
+		}{}
+		if err := callLokaliseAPI(ctx, http.MethodGet, path, nil, &result); err != nil {
+			return nil, utils.WrapError(err)
+		}
+
+		process := &result.Process
+		switch process.Status {
+		case "finished":
+			if len(process.Details.DownloadURL) == 0 {
+				return nil, utils.WrapError(errors.New("finished export has no download URL"))
+			}
+			return process, nil
+		case "failed", "cancelled":
+			return nil, utils.WrapError(fmt.Errorf("export %s: %s", process.Status, process.Message))
+		}
+
+		args["status"] = process.Status
+		args["delay"] = logging.Duration(delay)
+		logging.Debug().LogArgs("export {{.process_id}} is {{.status}} - polling again in {{.delay}}", args)
+
+		select {
+		case <-ctx.Done():
+			return nil, utils.WrapError(ctx.Err())
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > exportMaxPollDelay {
+			delay = exportMaxPollDelay
+		}
+	}
+}
+
+// downloadExport fetches the archive of a finished export, unless it has the
+// ETag recorded for etagKey. The URL is presigned, so no API token is sent.
+func downloadExport(ctx context.Context, url, etagKey string) ([]byte, error) {
+	etag := BundleETags.ETag(etagKey)
+	response, err := doWithRetry(ctx, HTTPClient, APIRetryPolicy, func(ctx context.Context) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, utils.WrapError(err)
+		}
+
+		if len(etag) > 0 {
+			request.Header.Set("If-None-Match", etag)
+		}
+		return request, nil
+	})
+
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified {
+		return nil, ErrBundleUnchanged
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, utils.WrapError(fmt.Errorf("unexpected status downloading export: %s", response.Status))
+	}
+
+	bundle, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+
+	if etag := response.Header.Get("ETag"); len(etag) > 0 {
+		BundleETags.SetETag(etagKey, etag)
+	}
+	return bundle, nil
+}
@@ -0,0 +1,59 @@
+package lokalise
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExportAPI serves the export endpoints for the fixture project, with a
+// bundle whose ETag is etag, answering If-None-Match with a 304.
+func fakeExportAPI(t *testing.T, etag string) {
+	t.Helper()
+
+	var server string
+	server = fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/api2/projects/4583214661dc12ab0c5b97.46071196/files/async-download":
+			writer.Write([]byte(`{"process_id":"p1"}`))
+		case "/api2/projects/4583214661dc12ab0c5b97.46071196/processes/p1":
+			writer.Write([]byte(`{"process":{"process_id":"p1","status":"finished","details":{"download_url":"` + server + `/bundle.zip"}}}`))
+		case "/bundle.zip":
+			writer.Header().Set("ETag", etag)
+			if request.Header.Get("If-None-Match") == etag {
+				writer.WriteHeader(http.StatusNotModified)
+				return
+			}
+			writer.Write([]byte("bundle"))
+		default:
+			t.Errorf("unexpected request to %s", request.URL.Path)
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}).URL
+
+	previous := BundleETags
+	BundleETags = NewMemoryETagStore()
+	t.Cleanup(func() { BundleETags = previous })
+}
+
+func TestUnchangedBundleSkipsLaterHandlers(t *testing.T) {
+	fakeExportAPI(t, `"v1"`)
+	server := NewTestServer(t)
+	server.Router.SetDeduplication(0, 0)
+	server.Router.AddHandler("project.translation.updated", downloadBundleForEvent)
+	notified := 0
+	server.Router.AddHandler("project.translation.updated", func(ctx context.Context, event *LokaliseEvent) error {
+		notified++
+		return nil
+	})
+
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.translation.updated").StatusCode)
+	assert.Equal(t, 1, notified)
+
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.translation.updated").StatusCode)
+	assert.Equal(t, 1, notified)
+	assert.True(t, server.hasLogLine("info", "translation bundle of project 4583214661dc12ab0c5b97.46071196 is unchanged - skipping it"))
+	assert.True(t, server.hasLogLine("info", "processed webhook event project.translation.updated"))
+}
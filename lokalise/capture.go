@@ -0,0 +1,149 @@
+package lokalise
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+// capturedIDRegexp matches the IDs of captured payloads, so that Load never
+// reads outside the store's directory.
+var capturedIDRegexp = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}\.[0-9]{9}-[0-9]+$`)
+
+// CapturedPayload is a webhook request as received, with the decision the
+// router took on it, e.g. "processed" or "duplicate".
+type CapturedPayload struct {
+	ID         string      `json:"id"`
+	ReceivedAt time.Time   `json:"received_at"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+	Decision   string      `json:"decision"`
+}
+
+// PayloadStore keeps the most recent webhook payloads in a directory, one
+// file per payload, deleting the oldest beyond a number of files or a total
+// size, for debugging and for replays.
+type PayloadStore struct {
+	dir      string
+	maxCount int
+	maxBytes int64
+
+	mutex sync.Mutex
+	seq   uint64
+}
+
+// NewPayloadStore returns a store keeping up to maxCount payloads, and up to
+// maxBytes of them, in dir, creating it if needed. A limit of 0 or less is
+// no limit.
+func NewPayloadStore(dir string, maxCount int, maxBytes int64) (*PayloadStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, utils.WrapError(err)
+	}
+	return &PayloadStore{dir: dir, maxCount: maxCount, maxBytes: maxBytes}, nil
+}
+
+// Save writes payload, with an ID assigned from its reception time, and
+// deletes the oldest payloads beyond the limits. The secret headers are
+// redacted.
+func (store *PayloadStore) Save(payload CapturedPayload) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.seq++
+	payload.ID = fmt.Sprintf("%s-%d", payload.ReceivedAt.UTC().Format("20060102T150405.000000000"), store.seq)
+
+	payload.Header = payload.Header.Clone()
+	for _, key := range []string{lokaliseWebhookSecretHeaderKey, "X-Secret-Token", "Authorization"} {
+		if len(payload.Header.Values(key)) > 0 {
+			payload.Header.Set(key, logging.Redacted)
+		}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", utils.WrapError(err)
+	}
+
+	if err := ioutil.WriteFile(store.path(payload.ID), data, 0o600); err != nil {
+		return "", utils.WrapError(err)
+	}
+
+	if err := store.prune(); err != nil {
+		return payload.ID, utils.WrapError(err)
+	}
+	return payload.ID, nil
+}
+
+// Load reads the payload saved with id.
+func (store *PayloadStore) Load(id string) (*CapturedPayload, error) {
+	if !capturedIDRegexp.MatchString(id) {
+		return nil, utils.WrapError(fmt.Errorf("invalid payload ID %q", id))
+	}
+
+	data, err := ioutil.ReadFile(store.path(id))
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+
+	payload := &CapturedPayload{}
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, utils.WrapError(err)
+	}
+	return payload, nil
+}
+
+func (store *PayloadStore) path(id string) string {
+	return filepath.Join(store.dir, id+".json")
+}
+
+// prune deletes the oldest payloads beyond the limits. The mutex must be
+// held.
+func (store *PayloadStore) prune() error {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return utils.WrapError(err)
+	}
+
+	type file struct {
+		name string
+		size int64
+	}
+	var files []file
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{name: entry.Name(), size: info.Size()})
+		total += info.Size()
+	}
+
+	// IDs start with the reception time, so names sort oldest first.
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+
+	var errs []error
+	for len(files) > 0 && ((store.maxCount > 0 && len(files) > store.maxCount) || (store.maxBytes > 0 && total > store.maxBytes)) {
+		if err := os.Remove(filepath.Join(store.dir, files[0].name)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		total -= files[0].size
+		files = files[1:]
+	}
+	return errors.Join(errs...)
+}
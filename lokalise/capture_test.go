@@ -0,0 +1,155 @@
+package lokalise
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// savePayloads saves a payload with body of each of the given sizes, received
+// a second apart from start, returning their IDs.
+func savePayloads(t *testing.T, store *PayloadStore, start time.Time, sizes ...int) []string {
+	t.Helper()
+
+	var ids []string
+	for i, size := range sizes {
+		id, err := store.Save(CapturedPayload{
+			ReceivedAt: start.Add(time.Duration(i) * time.Second),
+			Body:       strings.Repeat("x", size),
+			Decision:   "processed",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// storedIDs returns the IDs of the payloads in dir, sorted.
+func storedIDs(t *testing.T, dir string) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, path := range paths {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestPayloadStoreRoundTrip(t *testing.T) {
+	store, err := NewPayloadStore(filepath.Join(t.TempDir(), "payloads"), 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	received := time.Date(2024, 3, 1, 12, 0, 0, 123, time.UTC)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(lokaliseWebhookSecretHeaderKey, testWebhookSecret)
+	header.Set("X-Secret-Token", "token")
+	header.Set("Authorization", "Bearer token")
+
+	id, err := store.Save(CapturedPayload{
+		ReceivedAt: received,
+		Header:     header,
+		Body:       `{"event":"project.imported"}`,
+		Decision:   "processed",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "20240301T120000.000000123-1", id)
+	// The caller's header is left alone.
+	assert.Equal(t, testWebhookSecret, header.Get(lokaliseWebhookSecretHeaderKey))
+
+	payload, err := store.Load(id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, id, payload.ID)
+		assert.True(t, received.Equal(payload.ReceivedAt))
+		assert.Equal(t, `{"event":"project.imported"}`, payload.Body)
+		assert.Equal(t, "processed", payload.Decision)
+		assert.Equal(t, "application/json", payload.Header.Get("Content-Type"))
+		for _, key := range []string{lokaliseWebhookSecretHeaderKey, "X-Secret-Token", "Authorization"} {
+			assert.Equal(t, []string{logging.Redacted}, payload.Header.Values(key), key)
+		}
+	}
+
+	// Nothing secret reaches the disk.
+	data, err := os.ReadFile(store.path(id))
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(data), testWebhookSecret)
+		assert.NotContains(t, string(data), "token")
+	}
+}
+
+func TestPayloadStoreLoadRejectsInvalidIDs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewPayloadStore(filepath.Join(dir, "payloads"), 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// A file outside the store that a traversal would read.
+	if err := os.WriteFile(filepath.Join(dir, "x.json"), []byte(`{"body":"outside"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"", "../x", "a/b", "20240301T120000.000000000-1/../../x", "20240301T120000.000000000-1.json"} {
+		payload, err := store.Load(id)
+		assert.Nil(t, payload, id)
+		if assert.Error(t, err, id) {
+			assert.Contains(t, err.Error(), "invalid payload ID", id)
+		}
+	}
+
+	// A valid ID that was never saved isn't found.
+	_, err = store.Load("20240301T120000.000000000-1")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestPayloadStorePrunesBeyondMaxCount(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewPayloadStore(dir, 2, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ids := savePayloads(t, store, time.Now(), 10, 10, 10, 10)
+
+	assert.Equal(t, ids[2:], storedIDs(t, dir))
+}
+
+func TestPayloadStorePrunesBeyondMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewPayloadStore(dir, 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ids := savePayloads(t, store, start, 1000)
+	info, err := os.Stat(store.path(ids[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two files fit, not three, so the oldest one goes.
+	store.maxBytes = 2*info.Size() + info.Size()/2
+	ids = append(ids, savePayloads(t, store, start.Add(time.Minute), 1000, 1000)...)
+	assert.Equal(t, ids[1:], storedIDs(t, dir))
+
+	// A payload larger than the limit on its own is deleted too.
+	savePayloads(t, store, start.Add(time.Hour), 3000)
+	assert.Empty(t, storedIDs(t, dir))
+}
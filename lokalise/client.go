@@ -0,0 +1,64 @@
+package lokalise
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+)
+
+// SlowRequestThreshold is the time to a response beyond which outbound calls
+// are logged at warn.
+var SlowRequestThreshold = 5 * time.Second
+
+// HTTPClient is the client of all outbound calls, to the Lokalise API and to
+// Slack. Its timeouts keep a stalled connection from holding a goroutine
+// forever, and its pool reuses connections between calls.
+var HTTPClient = &http.Client{
+	Timeout: 2 * time.Minute,
+	Transport: slowRequestLogger{
+		next: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			ExpectContinueTimeout: time.Second,
+			MaxIdleConns:          20,
+			MaxIdleConnsPerHost:   10,
+			MaxConnsPerHost:       20,
+			IdleConnTimeout:       90 * time.Second,
+			ForceAttemptHTTP2:     true,
+		},
+	},
+}
+
+// slowRequestLogger is an http.RoundTripper logging the requests whose
+// response takes longer than SlowRequestThreshold to arrive.
+type slowRequestLogger struct {
+	next http.RoundTripper
+}
+
+func (logger slowRequestLogger) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := logger.next.RoundTrip(request)
+
+	if elapsed := time.Since(start); elapsed > SlowRequestThreshold {
+		args := logging.Args{
+			"method":     request.Method,
+			"host":       request.URL.Host,
+			"path":       request.URL.Path,
+			"elapsed":    logging.Duration(elapsed),
+			"elapsed_ms": logging.DurationMillis(elapsed),
+		}
+		if response != nil {
+			args["status"] = logging.HTTPStatus(response.StatusCode)
+		}
+		logging.Warn().WithContext(request.Context()).LogArgs("slow outbound request to {{.host}} took {{.elapsed}}", args)
+	}
+
+	return response, err
+}
@@ -0,0 +1,99 @@
+package lokalise
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupSize = 1024
+	defaultDedupTTL  = 10 * time.Minute
+)
+
+// eventKey identifies a webhook event across redeliveries: its type, its
+// project and a hash of the whole payload, which includes the time the event
+// was created.
+func eventKey(event *LokaliseEvent) string {
+	sum := sha256.Sum256(event.Payload)
+	return event.Event + "/" + event.Project.ID + "/" + hex.EncodeToString(sum[:])
+}
+
+// dedupCache remembers the keys of recently processed events for ttl,
+// evicting the oldest beyond size.
+//
+// It is best-effort: it lives in the memory of a single process, so a
+// redelivery reaching another replica, or arriving after a restart or once
+// the key has been evicted, is processed again. Sharing the keys between
+// replicas would need an external store.
+type dedupCache struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+func newDedupCache(size int, ttl time.Duration) *dedupCache {
+	return &dedupCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// reserve records key as being processed at now, reporting whether it
+// wasn't already recorded less than ttl before. Checking and recording in
+// one step lets only one of concurrent redeliveries through; the caller
+// releases the key if processing the event fails.
+func (cache *dedupCache) reserve(key string, now time.Time) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok && !now.After(element.Value.(*dedupEntry).expires) {
+		return false
+	}
+	cache.push(key, now)
+	return true
+}
+
+// add records key as processed at now.
+func (cache *dedupCache) add(key string, now time.Time) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.push(key, now)
+}
+
+// release forgets key, so that a redelivery of its event is processed.
+func (cache *dedupCache) release(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.order.Remove(element)
+		delete(cache.entries, key)
+	}
+}
+
+// push records key at now as the newest entry, evicting the oldest beyond
+// size. The mutex must be held.
+func (cache *dedupCache) push(key string, now time.Time) {
+	if element, ok := cache.entries[key]; ok {
+		cache.order.Remove(element)
+	}
+	cache.entries[key] = cache.order.PushBack(&dedupEntry{key: key, expires: now.Add(cache.ttl)})
+
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Front()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*dedupEntry).key)
+	}
+}
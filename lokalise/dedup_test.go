@@ -0,0 +1,66 @@
+package lokalise
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupCacheExpires(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := newDedupCache(10, time.Minute)
+
+	assert.True(t, cache.reserve("a", start))
+	assert.False(t, cache.reserve("a", start.Add(time.Minute)))
+	assert.True(t, cache.reserve("a", start.Add(time.Minute+time.Second)))
+}
+
+func TestDedupCacheEvictsOldest(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := newDedupCache(2, time.Minute)
+
+	cache.add("a", start)
+	cache.add("b", start)
+	// Adding a again makes b the oldest.
+	cache.add("a", start)
+	cache.add("c", start)
+
+	assert.Len(t, cache.entries, 2)
+	assert.False(t, cache.reserve("a", start))
+	assert.False(t, cache.reserve("c", start))
+	assert.True(t, cache.reserve("b", start))
+}
+
+func TestDedupCacheRelease(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := newDedupCache(10, time.Minute)
+
+	assert.True(t, cache.reserve("a", start))
+	cache.release("a")
+	cache.release("missing")
+	assert.True(t, cache.reserve("a", start))
+	assert.Equal(t, 1, cache.order.Len())
+}
+
+func TestDedupCacheReservesOnce(t *testing.T) {
+	cache := newDedupCache(10, time.Minute)
+	now := time.Now()
+
+	var reserved int32
+	var group sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if cache.reserve("a", now) {
+				atomic.AddInt32(&reserved, 1)
+			}
+		}()
+	}
+	group.Wait()
+
+	assert.Equal(t, int32(1), reserved)
+}
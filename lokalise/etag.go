@@ -0,0 +1,49 @@
+package lokalise
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrBundleUnchanged is returned by DownloadBundle when the bundle is the
+// same as the one it downloaded last time for the project and settings.
+var ErrBundleUnchanged = errors.New("bundle unchanged since the last download")
+
+// ETagStore remembers the ETag of the last bundle downloaded for a key.
+type ETagStore interface {
+	// ETag returns the ETag recorded for key, or "" if there is none.
+	ETag(key string) string
+
+	// SetETag records etag for key.
+	SetETag(key, etag string)
+}
+
+// BundleETags holds the ETags DownloadBundle sends with If-None-Match. It is
+// kept in memory by default.
+var BundleETags ETagStore = NewMemoryETagStore()
+
+// MemoryETagStore is an ETagStore kept in memory, so it is per process and
+// starts empty.
+type MemoryETagStore struct {
+	mutex sync.RWMutex
+	etags map[string]string
+}
+
+// NewMemoryETagStore returns an empty MemoryETagStore.
+func NewMemoryETagStore() *MemoryETagStore {
+	return &MemoryETagStore{etags: map[string]string{}}
+}
+
+// ETag implements ETagStore.
+func (store *MemoryETagStore) ETag(key string) string {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.etags[key]
+}
+
+// SetETag implements ETagStore.
+func (store *MemoryETagStore) SetETag(key, etag string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.etags[key] = etag
+}
@@ -0,0 +1,388 @@
+package lokalise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+// LokaliseProject identifies the project a webhook event is about.
+type LokaliseProject struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// LokaliseUser identifies the user who triggered a webhook event.
+type LokaliseUser struct {
+	Email    string `json:"email"`
+	FullName string `json:"full_name"`
+}
+
+// LokaliseEvent is a webhook event sent by Lokalise. Payload holds the whole
+// event as received, for handlers that need event-specific fields.
+type LokaliseEvent struct {
+	Event              string          `json:"event"`
+	Project            LokaliseProject `json:"project"`
+	User               *LokaliseUser   `json:"user,omitempty"`
+	CreatedAt          string          `json:"created_at,omitempty"`
+	CreatedAtTimestamp int64           `json:"created_at_timestamp,omitempty"`
+	Payload            json.RawMessage `json:"-"`
+}
+
+// DecodeLokaliseEvent reads a webhook event from body. Events must have a
+// type and a project ID.
+func DecodeLokaliseEvent(body io.Reader) (*LokaliseEvent, error) {
+	return decodeLokaliseEvent(body, false)
+}
+
+// decodeLokaliseEvent reads a webhook event from body, rejecting fields that
+// LokaliseEvent doesn't have if strict is set.
+func decodeLokaliseEvent(body io.Reader, strict bool) (*LokaliseEvent, error) {
+	payload, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+
+	event := &LokaliseEvent{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(event); err != nil {
+		return nil, utils.WrapError(err)
+	}
+
+	var missing []string
+	if len(event.Event) == 0 {
+		missing = append(missing, "event")
+	}
+	if len(event.Project.ID) == 0 {
+		missing = append(missing, "project.id")
+	}
+	if len(missing) > 0 {
+		return nil, utils.WrapError(fmt.Errorf("event is missing required fields: %s", strings.Join(missing, ", ")))
+	}
+
+	event.Payload = payload
+	return event, nil
+}
+
+// queueFullRetryAfter is the delay after which Lokalise is asked to send an
+// event again when the worker pool has no room for it.
+const queueFullRetryAfter = 30 * time.Second
+
+// ErrSkipHandlers is returned by an EventHandler to stop the handlers added
+// after it from running, e.g. when there is nothing new to act on. The event
+// still counts as processed successfully.
+var ErrSkipHandlers = errors.New("skip the remaining handlers")
+
+// EventHandler processes one webhook event. Returning an error makes the
+// webhook fail, so that Lokalise sends it again later, except for
+// ErrSkipHandlers. ctx is cancelled when
+// the processing should stop, e.g. when the server shuts down.
+type EventHandler func(ctx context.Context, event *LokaliseEvent) error
+
+// EventRouter is an http.Handler that decodes webhook events and dispatches
+// them to the handler registered for their type, such as
+// "project.translation.updated". Events without a handler are acknowledged,
+// so Lokalise doesn't keep retrying them. Events already processed
+// recently are acknowledged without being dispatched again, see
+// SetDeduplication.
+type EventRouter struct {
+	mutex    sync.RWMutex
+	handlers map[string]EventHandler
+	dedup    *dedupCache
+	pool     *WorkerPool
+	strict   bool
+	store    *PayloadStore
+
+	// allowed and denied are the project filter, see SetProjectFilter.
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+// NewEventRouter returns a router without any handlers.
+func NewEventRouter() *EventRouter {
+	return &EventRouter{
+		handlers: map[string]EventHandler{},
+		dedup:    newDedupCache(defaultDedupSize, defaultDedupTTL),
+	}
+}
+
+// AddHandler registers handler for events of the given type. Handlers
+// registered for the same type run in the order they were added, and never
+// replace one another; a handler only runs if the ones before it succeeded.
+func (router *EventRouter) AddHandler(event string, handler EventHandler) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	previous, ok := router.handlers[event]
+	if !ok {
+		router.handlers[event] = handler
+		return
+	}
+
+	router.handlers[event] = func(ctx context.Context, event *LokaliseEvent) error {
+		if err := previous(ctx, event); err != nil {
+			return err
+		}
+		return handler(ctx, event)
+	}
+}
+
+// SetPayloadStore makes the router save every webhook it receives, with its
+// headers and the decision taken on it, to store. Failures to save are
+// logged without failing the webhook. A nil store, the default, saves
+// nothing.
+func (router *EventRouter) SetPayloadStore(store *PayloadStore) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.store = store
+}
+
+// SetWorkerPool makes the router queue events to pool and acknowledge them
+// straight away instead of processing them before responding. The response
+// is a 503 with a Retry-After header if the queue is full, so that Lokalise
+// sends the event again later. A nil pool restores processing in the
+// request, which is the default.
+func (router *EventRouter) SetWorkerPool(pool *WorkerPool) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.pool = pool
+}
+
+// SetProjectFilter makes the router only dispatch the events of the projects
+// in allow, unless allow is empty, and never the events of the projects in
+// deny. Filtered events are acknowledged with a 200 without being processed.
+func (router *EventRouter) SetProjectFilter(allow, deny []string) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.allowed = projectSet(allow)
+	router.denied = projectSet(deny)
+}
+
+// projectSet returns the set of projectIDs, or nil if there are none.
+func projectSet(projectIDs []string) map[string]bool {
+	if len(projectIDs) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool, len(projectIDs))
+	for _, projectID := range projectIDs {
+		set[projectID] = true
+	}
+	return set
+}
+
+// acceptsProject reports whether the project filter lets the events of
+// projectID through. The mutex must be held.
+func (router *EventRouter) acceptsProject(projectID string) bool {
+	if router.denied[projectID] {
+		return false
+	}
+	return router.allowed == nil || router.allowed[projectID]
+}
+
+// SetStrictDecoding makes the router reject events with fields that
+// LokaliseEvent doesn't have with a 400, to notice early when Lokalise
+// changes its payloads. Since event-specific fields are rejected too, it is
+// only suitable when the events received carry no more than the common
+// fields. It is off by default.
+func (router *EventRouter) SetStrictDecoding(strict bool) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.strict = strict
+}
+
+// SetDeduplication makes the router remember up to size processed events for
+// ttl, answering redeliveries of them with a 200 without dispatching them
+// again, since Lokalise resends webhooks that time out. It defaults to 1024
+// events for 10 minutes. A size or ttl of 0 or less disables it.
+//
+// Deduplication is best-effort and per replica: the processed events are
+// only remembered in memory, so a redelivery reaching another replica or a
+// restarted process is processed again.
+func (router *EventRouter) SetDeduplication(size int, ttl time.Duration) {
+	var dedup *dedupCache
+	if size > 0 && ttl > 0 {
+		dedup = newDedupCache(size, ttl)
+	}
+
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.dedup = dedup
+}
+
+func (router *EventRouter) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	received := time.Now()
+
+	router.mutex.RLock()
+	strict := router.strict
+	store := router.store
+	router.mutex.RUnlock()
+
+	payload, err := ioutil.ReadAll(request.Body)
+	if err := request.Body.Close(); err != nil {
+		logging.Error().WithContext(ctx).LogErr("failed to close request body", err)
+	}
+
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		logging.Error().WithContext(ctx).LogErr("failed to read webhook body", err)
+		return
+	}
+
+	decision := router.serveEvent(ctx, writer, request.Header, payload, strict)
+
+	if store != nil {
+		id, err := store.Save(CapturedPayload{
+			ReceivedAt: received,
+			Header:     request.Header,
+			Body:       string(payload),
+			Decision:   decision,
+		})
+		args := logging.Args{"capture_id": id, "decision": decision}
+		if err != nil {
+			logging.Warn().WithContext(ctx).LogErr("failed to capture webhook payload", err)
+		} else {
+			logging.Audit().WithContext(ctx).LogArgs("wrote webhook payload {{.capture_id}}", args)
+		}
+	}
+}
+
+// serveEvent decodes and dispatches a webhook payload, returning the
+// decision taken on it.
+func (router *EventRouter) serveEvent(ctx context.Context, writer http.ResponseWriter, header http.Header, payload []byte, strict bool) string {
+	if mediaType, _, err := mime.ParseMediaType(header.Get(utils.ContentTypeHeader)); err != nil || mediaType != "application/json" {
+		http.Error(writer, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		logging.Error().WithContext(ctx).LogArgs("rejected webhook with content type {{.content_type}} instead of application/json",
+			logging.Args{
+				"content_type": header.Get(utils.ContentTypeHeader),
+			})
+		return "unsupported_media_type"
+	}
+
+	event, err := decodeLokaliseEvent(bytes.NewReader(payload), strict)
+	if err != nil {
+		http.Error(writer, "malformed event", http.StatusBadRequest)
+		logging.Error().WithContext(ctx).LogErr("failed to decode webhook event", err)
+		return "malformed"
+	}
+
+	return router.dispatch(ctx, writer, event, false)
+}
+
+// dispatch responds to a decoded event by running or queueing its handler,
+// returning the decision taken on it. Replayed events are dispatched even if
+// they were processed recently.
+func (router *EventRouter) dispatch(ctx context.Context, writer http.ResponseWriter, event *LokaliseEvent, replay bool) string {
+	args := logging.Args{
+		"event":      event.Event,
+		"project_id": event.Project.ID,
+	}
+
+	router.mutex.RLock()
+	accepted := router.acceptsProject(event.Project.ID)
+	handler, ok := router.handlers[event.Event]
+	dedup := router.dedup
+	pool := router.pool
+	router.mutex.RUnlock()
+
+	if !accepted {
+		logging.Debug().WithContext(ctx).LogArgs("ignoring webhook event {{.event}} of filtered project {{.project_id}}", args)
+		writer.WriteHeader(http.StatusOK)
+		return "filtered"
+	}
+
+	if !ok {
+		eventsReceived.WithLabelValues(unhandledEventLabel).Inc()
+		logging.Warn().WithContext(ctx).LogArgs("ignoring unhandled webhook event {{.event}}", args)
+		writer.WriteHeader(http.StatusOK)
+		return "unhandled"
+	}
+
+	// The event is reserved before it is processed, so that a redelivery
+	// arriving meanwhile isn't processed too, and released if it fails.
+	key := eventKey(event)
+	reserved := dedup != nil && !replay
+	if reserved && !dedup.reserve(key, time.Now()) {
+		logging.Debug().WithContext(ctx).LogArgs("ignoring redelivered webhook event {{.event}}", args)
+		writer.WriteHeader(http.StatusOK)
+		return "duplicate"
+	}
+
+	eventsReceived.WithLabelValues(event.Event).Inc()
+	if pool != nil {
+		if err := pool.Enqueue(ctx, event, handler); err != nil {
+			if reserved {
+				dedup.release(key)
+			}
+
+			// Lokalise redelivers the event later rather than it being lost,
+			// to another replica if this one is shutting down.
+			if errors.Is(err, ErrPoolClosed) {
+				http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				logging.Warn().WithContext(ctx).LogErrArgs("rejected webhook event {{.event}} while shutting down", err, args)
+				return "pool_closed"
+			}
+
+			writer.Header().Set("Retry-After", strconv.Itoa(int(queueFullRetryAfter.Seconds())))
+			http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			args["depth"] = logging.Int(pool.Depth())
+			args["capacity"] = logging.Int(cap(pool.queue))
+			logging.Warn().WithContext(ctx).LogErrArgs("failed to queue webhook event {{.event}} with {{.depth}} events queued", err, args)
+			return "queue_full"
+		}
+
+		if dedup != nil && replay {
+			dedup.add(key, time.Now())
+		}
+
+		logging.Debug().WithContext(ctx).LogArgs("queued webhook event {{.event}}", args)
+		writer.WriteHeader(http.StatusOK)
+		return "queued"
+	}
+
+	if err := observeEvent(ctx, handler, event); err != nil {
+		http.Error(writer, "failed to process event", http.StatusInternalServerError)
+		logProcessingError(ctx, err, args)
+		if reserved {
+			dedup.release(key)
+		}
+		return "failed"
+	}
+
+	if dedup != nil && replay {
+		dedup.add(key, time.Now())
+	}
+
+	logging.Info().WithContext(ctx).LogArgs("processed webhook event {{.event}}", args)
+	writer.WriteHeader(http.StatusOK)
+	return "processed"
+}
+
+// logProcessingError logs the failure to process an event, at warn if it
+// was cancelled, e.g. because the server is shutting down, rather than
+// failing.
+func logProcessingError(ctx context.Context, err error, args logging.Args) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		logging.Warn().WithContext(ctx).LogErrArgs("processing of webhook event {{.event}} was cancelled", err, args)
+		return
+	}
+	logging.Error().WithContext(ctx).LogErrArgs("failed to process webhook event {{.event}}", err, args)
+}
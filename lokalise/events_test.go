@@ -0,0 +1,333 @@
+package lokalise
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventRouterDispatchesFixtures(t *testing.T) {
+	for _, eventType := range []string{
+		"project.translation.updated",
+		"project.task.closed",
+		"team.order.completed",
+		"project.imported",
+	} {
+		t.Run(eventType, func(t *testing.T) {
+			server := NewTestServer(t)
+			var received *LokaliseEvent
+			server.Router.AddHandler(eventType, func(ctx context.Context, event *LokaliseEvent) error {
+				received = event
+				return nil
+			})
+
+			response := server.postEvent(t, eventType)
+
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			if assert.NotNil(t, received) {
+				assert.Equal(t, eventType, received.Event)
+				assert.Equal(t, "4583214661dc12ab0c5b97.46071196", received.Project.ID)
+			}
+			assert.True(t, server.hasLogLine("info", "processed webhook event "+eventType))
+		})
+	}
+}
+
+func TestEventRouterIgnoresRedeliveries(t *testing.T) {
+	server := NewTestServer(t)
+	calls := 0
+	server.Router.AddHandler("project.task.closed", func(ctx context.Context, event *LokaliseEvent) error {
+		calls++
+		return nil
+	})
+
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.task.closed").StatusCode)
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.task.closed").StatusCode)
+
+	assert.Equal(t, 1, calls)
+	assert.True(t, server.hasLogLine("debug", "ignoring redelivered webhook event project.task.closed"))
+}
+
+func TestEventRouterHandlerFailure(t *testing.T) {
+	server := NewTestServer(t)
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+		return errors.New("boom")
+	})
+
+	response := server.postEvent(t, "project.imported")
+
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.True(t, server.hasLogLine("error", "failed to process webhook event project.imported"))
+}
+
+func TestEventRouterUnhandledEvent(t *testing.T) {
+	server := NewTestServer(t)
+
+	response := server.postEvent(t, "project.translation.updated")
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.True(t, server.hasLogLine("warn", "ignoring unhandled webhook event project.translation.updated"))
+}
+
+func TestEventRouterQueueFull(t *testing.T) {
+	server := NewTestServer(t)
+	pool := NewWorkerPool(0, 0, 0, time.Minute)
+	defer pool.Close(context.Background())
+	server.Router.SetWorkerPool(pool)
+	server.Router.AddHandler("project.task.closed", func(ctx context.Context, event *LokaliseEvent) error {
+		return nil
+	})
+
+	response := server.postEvent(t, "project.task.closed")
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, "30", response.Header.Get("Retry-After"))
+	assert.True(t, server.hasLogLine("warn", "failed to queue webhook event project.task.closed with 0 events queued"))
+}
+
+func TestEventRouterPoolClosed(t *testing.T) {
+	server := NewTestServer(t)
+	pool := NewWorkerPool(1, 10, 0, time.Minute)
+	assert.NoError(t, pool.Close(context.Background()))
+	server.Router.SetWorkerPool(pool)
+	server.Router.AddHandler("project.task.closed", func(ctx context.Context, event *LokaliseEvent) error {
+		return nil
+	})
+
+	response := server.postEvent(t, "project.task.closed")
+
+	// Unlike a full queue, there is no point asking to retry this replica.
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Empty(t, response.Header.Get("Retry-After"))
+	assert.True(t, server.hasLogLine("warn", "rejected webhook event project.task.closed while shutting down"))
+	assert.False(t, server.hasLogLine("warn", "failed to queue webhook event project.task.closed with 0 events queued"))
+
+	decision := server.Router.dispatch(context.Background(), httptest.NewRecorder(), decodedFixture(t, "project.task.closed"), false)
+	assert.Equal(t, "pool_closed", decision)
+}
+
+func TestVerifyLokaliseSignatureRejectsInvalidSecret(t *testing.T) {
+	server := NewTestServer(t)
+	calls := 0
+	server.Router.AddHandler("project.task.closed", func(ctx context.Context, event *LokaliseEvent) error {
+		calls++
+		return nil
+	})
+
+	response := server.postPayload(t, eventFixture(t, "project.task.closed"), "wrong-secret")
+
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	assert.Equal(t, 0, calls)
+	assert.True(t, server.hasLogLine("error", "rejected webhook with an invalid secret"))
+}
+
+func TestEventRouterUnsupportedMediaType(t *testing.T) {
+	for _, test := range []struct {
+		name, contentType, encoding string
+		logged                      string
+	}{
+		{name: "text", contentType: "text/plain", logged: "rejected webhook with content type text/plain instead of application/json"},
+		{name: "no content type", logged: "rejected webhook with content type  instead of application/json"},
+		{name: "unknown encoding", contentType: "application/json", encoding: "br", logged: "rejected request body with unsupported content encoding br"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewTestServer(t)
+			calls := 0
+			server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+				calls++
+				return nil
+			})
+			request := server.newWebhookRequest(t, eventFixture(t, "project.imported"), testWebhookSecret)
+			request.Header.Set(utils.ContentTypeHeader, test.contentType)
+			if len(test.encoding) > 0 {
+				request.Header.Set("Content-Encoding", test.encoding)
+			}
+
+			response := server.do(t, request)
+
+			assert.Equal(t, http.StatusUnsupportedMediaType, response.StatusCode)
+			assert.Equal(t, 0, calls)
+			assert.True(t, server.hasLogLine("error", test.logged))
+		})
+	}
+
+	// Parameters of the media type are allowed.
+	server := NewTestServer(t)
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error { return nil })
+	request := server.newWebhookRequest(t, eventFixture(t, "project.imported"), testWebhookSecret)
+	request.Header.Set(utils.ContentTypeHeader, "application/json; charset=utf-8")
+	assert.Equal(t, http.StatusOK, server.do(t, request).StatusCode)
+}
+
+func TestEventRouterGzippedBody(t *testing.T) {
+	server := NewTestServer(t)
+	var received *LokaliseEvent
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+		received = event
+		return nil
+	})
+
+	payload := eventFixture(t, "project.imported")
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(payload)
+	writer.Close()
+	request := server.newWebhookRequest(t, compressed.Bytes(), testWebhookSecret)
+	request.Header.Set("Content-Encoding", "gzip")
+
+	response := server.do(t, request)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	if assert.NotNil(t, received) {
+		assert.Equal(t, "4583214661dc12ab0c5b97.46071196", received.Project.ID)
+	}
+	assert.True(t, server.hasLogLine("debug", fmt.Sprintf("decompressed gzip request body of %d bytes", len(payload))))
+}
+
+func TestEventRouterMalformedGzippedBody(t *testing.T) {
+	server := NewTestServer(t)
+	request := server.newWebhookRequest(t, eventFixture(t, "project.imported"), testWebhookSecret)
+	request.Header.Set("Content-Encoding", "gzip")
+
+	response := server.do(t, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.True(t, server.hasLogLine("error", "rejected malformed gzip request body"))
+}
+
+func TestEventRouterGzippedBodyTooLarge(t *testing.T) {
+	server := NewTestServer(t)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(make([]byte, utils.DefaultMaxBodyBytes+1))
+	writer.Close()
+	request := server.newWebhookRequest(t, compressed.Bytes(), testWebhookSecret)
+	request.Header.Set("Content-Encoding", "gzip")
+
+	response := server.do(t, request)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode)
+}
+
+func TestEventRouterChainsHandlers(t *testing.T) {
+	server := NewTestServer(t)
+	var calls []string
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+		calls = append(calls, "second")
+		return errors.New("boom")
+	})
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+		calls = append(calls, "third")
+		return nil
+	})
+
+	response := server.postEvent(t, "project.imported")
+
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
+func TestEventRouterIgnoresConcurrentRedeliveries(t *testing.T) {
+	server := NewTestServer(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	server.Router.AddHandler("project.task.closed", func(ctx context.Context, event *LokaliseEvent) error {
+		calls++
+		close(started)
+		<-release
+		return nil
+	})
+
+	first := server.newWebhookRequest(t, eventFixture(t, "project.task.closed"), testWebhookSecret)
+	done := make(chan int)
+	go func() {
+		response, err := server.Client().Do(first)
+		if err != nil {
+			done <- 0
+			return
+		}
+		response.Body.Close()
+		done <- response.StatusCode
+	}()
+
+	// The redelivery arrives while the first delivery is still processed.
+	<-started
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.task.closed").StatusCode)
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+
+	assert.Equal(t, 1, calls)
+	assert.True(t, server.hasLogLine("debug", "ignoring redelivered webhook event project.task.closed"))
+}
+
+func TestEventRouterProcessesRedeliveriesOfFailedEvents(t *testing.T) {
+	server := NewTestServer(t)
+	calls := 0
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+		calls++
+		if calls == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, server.postEvent(t, "project.imported").StatusCode)
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.imported").StatusCode)
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.imported").StatusCode)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestEventRouterProjectFilter(t *testing.T) {
+	const projectID = "4583214661dc12ab0c5b97.46071196"
+	for _, test := range []struct {
+		name        string
+		allow, deny []string
+		processed   bool
+	}{
+		{name: "no filter", processed: true},
+		{name: "empty lists", allow: []string{}, deny: []string{}, processed: true},
+		{name: "allowed", allow: []string{"other", projectID}, processed: true},
+		{name: "not allowed", allow: []string{"other"}},
+		{name: "denied", deny: []string{projectID}},
+		{name: "allowed but denied", allow: []string{projectID}, deny: []string{projectID}},
+		{name: "other project denied", deny: []string{"other"}, processed: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewTestServer(t)
+			server.Router.SetProjectFilter(test.allow, test.deny)
+			calls := 0
+			server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+				calls++
+				return nil
+			})
+
+			// Filtered events are acknowledged all the same, so that Lokalise
+			// doesn't resend them.
+			assert.Equal(t, http.StatusOK, server.postEvent(t, "project.imported").StatusCode)
+
+			if test.processed {
+				assert.Equal(t, 1, calls)
+				assert.True(t, server.hasLogLine("info", "processed webhook event project.imported"))
+			} else {
+				assert.Equal(t, 0, calls)
+				assert.True(t, server.hasLogLine("debug", "ignoring webhook event project.imported of filtered project "+projectID))
+			}
+		})
+	}
+}
@@ -1,43 +1,145 @@
 package lokalise
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
 )
 
+// VerifyLokaliseSignature only passes requests on to next if their X-Secret
+// header matches one of the webhook secrets configured in Lokalise, and
+// responds with a 401 otherwise, so that events can't be forged by anyone who
+// learns the webhook URL. Several secrets are accepted while the secret is
+// rotated, and the index of the one matched is logged, to tell when the old
+// one is no longer used. Every request is rejected if secrets is empty.
+func VerifyLokaliseSignature(secrets []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+
+		// The body is only read once the request is authenticated.
+		index, err := validateLokaliseWebhookSecret(request, secrets)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			logging.Error().WithContext(ctx).LogErrArgs("rejected webhook with an invalid secret", err,
+				logging.Args{
+					"remote_addr": request.RemoteAddr,
+				})
+			return
+		}
+
+		args := logging.Args{"secret_index": logging.Int(index)}
+		if projectID := peekProjectID(request); len(projectID) > 0 {
+			args["project_id"] = projectID
+		}
+
+		logging.Info().WithContext(ctx).LogArgs("accepted webhook with secret {{.secret_index}}", args)
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// DryRun makes the event handlers log the actions they would take, such as
+// creating a pull request or posting to Slack, instead of taking them.
+var DryRun = false
+
+// skippedInDryRun reports whether DryRun is set, logging the skipped action
+// with args if so.
+func skippedInDryRun(action string, args logging.Args) bool {
+	if !DryRun {
+		return false
+	}
+
+	args["action"] = action
+	logging.Info().LogArgs("dry run - skipped {{.action}}", args)
+	return true
+}
+
+// Events routes the webhook events received by TaskCompletedHandler.
+var Events = NewEventRouter()
+
+func init() {
+	Events.AddHandler("project.task.closed", createPullRequestForEvent)
+	Events.AddHandler("team.order.completed", createPullRequestForEvent)
+	Events.AddHandler("project.translation.updated", downloadBundleForEvent)
+}
+
 // TaskCompletedHandler responds to an incoming webhook from Lokalise
 // incdicating that translation task is complete and a pull request should
-// be created in the corresponding GitHub repository.
+// be created in the corresponding GitHub repository. Requests must be
+// verified with VerifyLokaliseSignature first. Events are dispatched with
+// Events.
 func TaskCompletedHandler(writer http.ResponseWriter, request *http.Request) {
-	if err := validateLokaliseWebhookSecret(request, lokaliseWebhookSecret); err != nil {
-		http.Error(writer, err.Error(), http.StatusForbidden)
-		logging.Error().LogErr("unable to validate webhook secret", err)
-		return
+	Events.ServeHTTP(writer, request)
+}
+
+func createPullRequestForEvent(ctx context.Context, event *LokaliseEvent) error {
+	if skippedInDryRun("creating a strings pull request", eventArgs(event)) {
+		return nil
 	}
 
-	jsonBody := struct {
-		Project struct {
-			ID string
-		}
-	}{}
+	err := createStringsPullRequest(ctx, event.Project.ID)
+	auditAction("triggered a strings pull request", event, nil, err)
+	return err
+}
 
-	body, err := ioutil.ReadAll(request.Body)
-	if err := request.Body.Close(); err != nil {
-		logging.Error().LogErr("failed to close request body", err)
+// auditAction records an action taken for event in the audit log, with its
+// outcome and any args describing it.
+func auditAction(action string, event *LokaliseEvent, args logging.Args, err error) {
+	auditArgs := eventArgs(event)
+	for k, v := range args {
+		auditArgs[k] = v
 	}
+	auditArgs["action"] = action
+	auditArgs["event_id"] = eventKey(event)
 
 	if err != nil {
-		logging.Error().LogErr("failed to read request body", err)
+		auditArgs["outcome"] = "failed"
+		logging.Audit().LogErrArgs("{{.action}} for project {{.project_id}}: {{.outcome}}", err, auditArgs)
 		return
 	}
 
-	if err := json.Unmarshal(body, &jsonBody); err != nil {
-		logging.Error().LogErr("failed to unmarshal JSON body", err)
-		return
+	auditArgs["outcome"] = "succeeded"
+	logging.Audit().LogArgs("{{.action}} for project {{.project_id}}: {{.outcome}}", auditArgs)
+}
+
+// eventArgs returns the log args identifying event.
+func eventArgs(event *LokaliseEvent) logging.Args {
+	return logging.Args{
+		"event":        event.Event,
+		"project_id":   event.Project.ID,
+		"project_name": event.Project.Name,
+	}
+}
+
+// BundleExportOptions are the settings of the bundles downloaded when
+// translations are updated.
+var BundleExportOptions = ExportOptions{Format: "json"}
+
+func downloadBundleForEvent(ctx context.Context, event *LokaliseEvent) error {
+	args := eventArgs(event)
+	args["format"] = BundleExportOptions.Format
+	if skippedInDryRun("downloading a translation bundle", args) {
+		return nil
+	}
+
+	bundle, err := DownloadBundle(ctx, event.Project.ID, BundleExportOptions)
+	if errors.Is(err, ErrBundleUnchanged) {
+		// The handlers after this one, e.g. the Slack notifier, have nothing
+		// new to report either.
+		logging.Info().LogArgs("translation bundle of project {{.project_id}} is unchanged - skipping it", args)
+		return ErrSkipHandlers
+	}
+	auditAction("downloaded a translation bundle", event, logging.Args{"size": logging.Int(len(bundle))}, err)
+	if err != nil {
+		return utils.WrapError(err)
 	}
 
-	createStringsPullRequest(jsonBody.Project.ID)
+	logging.Info().LogArgs("downloaded translation bundle of project {{.project_id}}",
+		logging.Args{
+			"project_id": event.Project.ID,
+			"size":       logging.Int(len(bundle)),
+		})
+	return nil
 }
@@ -0,0 +1,152 @@
+package lokalise
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePullRequestForEventAuditsOutcome(t *testing.T) {
+	for _, test := range []struct {
+		status  int
+		outcome string
+	}{
+		{http.StatusOK, "succeeded"},
+		{http.StatusBadRequest, "failed"},
+		{http.StatusForbidden, "failed"},
+		{http.StatusNotFound, "failed"},
+	} {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+				assert.Equal(t, "/api2/projects/4583214661dc12ab0c5b97.46071196/files/download", request.URL.Path)
+				writer.WriteHeader(test.status)
+			})
+			logs, restore := logtest.Capture()
+			defer restore()
+
+			err := createPullRequestForEvent(context.Background(), decodedFixture(t, "project.task.closed"))
+
+			if test.outcome == "failed" {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			entries := auditEntries(logs)
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, test.outcome, entries[0]["arg_outcome"])
+				assert.Equal(t, "triggered a strings pull request", entries[0]["arg_action"])
+			}
+		})
+	}
+}
+
+// readCounter is a request body counting the bytes read from it.
+type readCounter struct {
+	io.Reader
+	read int
+}
+
+func (counter *readCounter) Read(p []byte) (int, error) {
+	n, err := counter.Reader.Read(p)
+	counter.read += n
+	return n, err
+}
+
+func TestVerifyLokaliseSignature(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		secrets []string
+		secret  string
+		status  int
+		index   string
+	}{
+		{"current secret", []string{"new", "old"}, "new", http.StatusOK, "0"},
+		{"previous secret", []string{"new", "old"}, "old", http.StatusOK, "1"},
+		{"wrong secret", []string{"new", "old"}, "other", http.StatusUnauthorized, ""},
+		{"missing secret", []string{"new"}, "", http.StatusUnauthorized, ""},
+		{"no secrets configured", nil, "", http.StatusUnauthorized, ""},
+		{"empty secret configured", []string{""}, "", http.StatusUnauthorized, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			logs, restore := logtest.Capture()
+			defer restore()
+
+			passed := false
+			handler := VerifyLokaliseSignature(test.secrets, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				passed = true
+			}))
+
+			body := &readCounter{Reader: bytes.NewReader(eventFixture(t, "project.task.closed"))}
+			request := httptest.NewRequest(http.MethodPost, "/order_complete", body)
+			request.Header.Set(lokaliseWebhookSecretHeaderKey, test.secret)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, test.status, recorder.Code)
+			assert.Equal(t, test.status == http.StatusOK, passed)
+			entries := logs.Entries()
+			if !assert.Len(t, entries, 1) {
+				return
+			}
+			if test.status == http.StatusOK {
+				assert.Equal(t, "accepted webhook with secret "+test.index, entries[0]["msg"])
+				assert.Equal(t, "4583214661dc12ab0c5b97.46071196", entries[0]["arg_project_id"])
+			} else {
+				assert.Equal(t, "rejected webhook with an invalid secret", entries[0]["msg"])
+				assert.Zero(t, body.read, "the body of an unauthenticated request was read")
+			}
+		})
+	}
+}
+
+func TestDryRunMakesNoOutgoingCalls(t *testing.T) {
+	DryRun = true
+	defer func() { DryRun = false }()
+	var hits atomic.Int32
+	fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+		hits.Add(1)
+		t.Errorf("unexpected request to %s in a dry run", request.URL.Path)
+	})
+	slack := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		hits.Add(1)
+		t.Errorf("unexpected Slack notification in a dry run")
+	}))
+	defer slack.Close()
+
+	server := NewTestServer(t)
+	notifier := NewSlackNotifier(slack.URL)
+	server.Router.AddHandler("project.task.closed", createPullRequestForEvent)
+	server.Router.AddHandler("team.order.completed", createPullRequestForEvent)
+	server.Router.AddHandler("project.translation.updated", downloadBundleForEvent)
+	server.Router.AddHandler("project.translation.updated", notifier.Notify)
+
+	for _, event := range []string{"project.task.closed", "team.order.completed", "project.translation.updated"} {
+		assert.Equal(t, http.StatusOK, server.postEvent(t, event).StatusCode, event)
+	}
+
+	assert.Equal(t, int32(0), hits.Load())
+	assert.Empty(t, auditEntries(server.Logs))
+	var skipped []map[string]string
+	for _, entry := range server.Logs.Entries() {
+		if entry["msgTemplate"] == "dry run - skipped {{.action}}" {
+			skipped = append(skipped, entry)
+		}
+	}
+	if assert.Len(t, skipped, 4) {
+		assert.Equal(t, "creating a strings pull request", skipped[0]["arg_action"])
+		assert.Equal(t, "project.task.closed", skipped[0]["arg_event"])
+		assert.Equal(t, "4583214661dc12ab0c5b97.46071196", skipped[0]["arg_project_id"])
+		assert.Equal(t, "creating a strings pull request", skipped[1]["arg_action"])
+		assert.Equal(t, "downloading a translation bundle", skipped[2]["arg_action"])
+		assert.Equal(t, "json", skipped[2]["arg_format"])
+		assert.Equal(t, "notifying Slack", skipped[3]["arg_action"])
+		assert.NotEmpty(t, skipped[3]["arg_message"])
+	}
+}
@@ -0,0 +1,91 @@
+package lokalise
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unhandledEventLabel is the event label of events without a handler, so
+// that arbitrary event types can't grow the number of series.
+const unhandledEventLabel = "unhandled"
+
+var (
+	eventsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lokalise_events_received_total",
+		Help: "Webhook events received, by event type.",
+	}, []string{"event"})
+
+	eventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lokalise_events_processed_total",
+		Help: "Webhook events processed successfully, by event type.",
+	}, []string{"event"})
+
+	eventsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lokalise_events_failed_total",
+		Help: "Webhook events whose processing failed, by event type.",
+	}, []string{"event"})
+
+	eventProcessingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lokalise_event_processing_seconds",
+		Help:    "Time spent processing webhook events, by event type.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"event"})
+
+	eventQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "lokalise_event_queue_depth",
+		Help: "Webhook events waiting for a worker.",
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "lokalise_api_rate_limit",
+		Help: "Requests allowed in the Lokalise API rate limit window, as last reported.",
+	}, func() float64 {
+		rateLimit, _ := LatestRateLimit()
+		return float64(rateLimit.Limit)
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "lokalise_api_rate_limit_remaining",
+		Help: "Requests left in the Lokalise API rate limit window, as last reported.",
+	}, func() float64 {
+		rateLimit, _ := LatestRateLimit()
+		return float64(rateLimit.Remaining)
+	})
+)
+
+// observeEvent runs handler on event, recording its outcome and the time it
+// took in the metrics and RecentEvents. Panics count as failures and are
+// passed on.
+func observeEvent(ctx context.Context, handler EventHandler, event *LokaliseEvent) error {
+	start := time.Now()
+	failed := true
+	defer func() {
+		latency := time.Since(start)
+		eventProcessingSeconds.WithLabelValues(event.Event).Observe(latency.Seconds())
+		outcome := "processed"
+		if failed {
+			eventsFailed.WithLabelValues(event.Event).Inc()
+			outcome = "failed"
+		} else {
+			eventsProcessed.WithLabelValues(event.Event).Inc()
+		}
+		RecentEvents.Add(RecentEvent{
+			Event:       event.Event,
+			ProjectID:   event.Project.ID,
+			ProcessedAt: time.Now(),
+			Outcome:     outcome,
+			LatencyMS:   latency.Milliseconds(),
+		})
+	}()
+
+	err := handler(ctx, event)
+	if errors.Is(err, ErrSkipHandlers) {
+		err = nil
+	}
+	failed = err != nil
+	return err
+}
@@ -0,0 +1,104 @@
+package lokalise
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+const (
+	// DefaultMaxPages is the maximum number of pages ListAll fetches.
+	DefaultMaxPages = 100
+
+	// pageLimit is the number of items requested per page, the maximum most
+	// list endpoints allow.
+	pageLimit = 500
+
+	pageCountHeader  = "X-Pagination-Page-Count"
+	nextCursorHeader = "X-Pagination-Next-Cursor"
+)
+
+// ListPages fetches the list endpoint at path, e.g. "/api2/projects/<id>/keys",
+// one page at a time, calling onPage with the body of each page in order.
+// Pages are followed with the cursor returned by Lokalise if query sets
+// "pagination" to "cursor", and by page number otherwise. query may be nil.
+//
+// An error is returned, after the first maxPages pages, if there are more,
+// so that a partial list is never mistaken for the whole of it.
+func ListPages(ctx context.Context, path string, query url.Values, maxPages int, onPage func(page json.RawMessage) error) error {
+	pageQuery := url.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+	if len(pageQuery.Get("limit")) == 0 {
+		pageQuery.Set("limit", strconv.Itoa(pageLimit))
+	}
+	byCursor := pageQuery.Get("pagination") == "cursor"
+
+	args := logging.Args{"path": path}
+	for page := 1; ; page++ {
+		if page > maxPages {
+			return utils.WrapError(fmt.Errorf("%s has more than %d pages", path, maxPages))
+		}
+		if !byCursor {
+			pageQuery.Set("page", strconv.Itoa(page))
+		}
+
+		var body json.RawMessage
+		header, err := callLokaliseAPIHeader(ctx, http.MethodGet, path+"?"+pageQuery.Encode(), nil, &body)
+		if err != nil {
+			return utils.WrapError(err)
+		}
+
+		args["page"] = logging.Int(page)
+		logging.Debug().LogArgs("fetched page {{.page}} of {{.path}}", args)
+
+		if err := onPage(body); err != nil {
+			return utils.WrapError(err)
+		}
+
+		if byCursor {
+			cursor := header.Get(nextCursorHeader)
+			if len(cursor) == 0 {
+				return nil
+			}
+			pageQuery.Set("cursor", cursor)
+		} else if pageCount, _ := strconv.Atoi(header.Get(pageCountHeader)); page >= pageCount {
+			return nil
+		}
+	}
+}
+
+// ListAll returns the items of every page of the list endpoint at path,
+// decoded from the field of each page holding them, e.g. "keys" or
+// "translations". See ListPages for query and maxPages.
+func ListAll[T any](ctx context.Context, path string, query url.Values, field string, maxPages int) ([]T, error) {
+	var items []T
+	err := ListPages(ctx, path, query, maxPages, func(page json.RawMessage) error {
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(page, &fields); err != nil {
+			return utils.WrapError(err)
+		}
+
+		var pageItems []T
+		if raw, ok := fields[field]; ok {
+			if err := json.Unmarshal(raw, &pageItems); err != nil {
+				return utils.WrapError(err)
+			}
+		}
+
+		items = append(items, pageItems...)
+		return nil
+	})
+
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+	return items, nil
+}
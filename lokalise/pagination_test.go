@@ -0,0 +1,125 @@
+package lokalise
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const keysPath = "/api2/projects/4583214661dc12ab0c5b97.46071196/keys"
+
+type testKey struct {
+	KeyID int `json:"key_id"`
+}
+
+// keysPage is a page of the keys list holding the given key ids.
+func keysPage(ids ...int) []byte {
+	keys := []testKey{}
+	for _, id := range ids {
+		keys = append(keys, testKey{KeyID: id})
+	}
+	page, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return page
+}
+
+func TestListAllByPageCount(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+	var queries []url.Values
+	fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, keysPath, request.URL.Path)
+		query := request.URL.Query()
+		queries = append(queries, query)
+		page, _ := strconv.Atoi(query.Get("page"))
+		writer.Header().Set(pageCountHeader, "3")
+		writer.Write(keysPage(2*page-1, 2*page))
+	})
+
+	keys, err := ListAll[testKey](context.Background(), keysPath, url.Values{"filter_tags": {"web"}}, "keys", DefaultMaxPages)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []testKey{{1}, {2}, {3}, {4}, {5}, {6}}, keys)
+	if assert.Len(t, queries, 3) {
+		for i, query := range queries {
+			assert.Equal(t, strconv.Itoa(i+1), query.Get("page"))
+			assert.Equal(t, "500", query.Get("limit"))
+			assert.Equal(t, "web", query.Get("filter_tags"))
+		}
+	}
+}
+
+func TestListAllByCursor(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+	var cursors []string
+	fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+		assert.Empty(t, query.Get("page"))
+		cursor := query.Get("cursor")
+		cursors = append(cursors, cursor)
+		switch cursor {
+		case "":
+			writer.Header().Set(nextCursorHeader, "c2")
+			writer.Write(keysPage(1))
+		case "c2":
+			writer.Header().Set(nextCursorHeader, "c3")
+			writer.Write(keysPage(2))
+		default:
+			writer.Write(keysPage(3))
+		}
+	})
+
+	keys, err := ListAll[testKey](context.Background(), keysPath, url.Values{"pagination": {"cursor"}, "limit": {"1"}}, "keys", DefaultMaxPages)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []testKey{{1}, {2}, {3}}, keys)
+	assert.Equal(t, []string{"", "c2", "c3"}, cursors)
+}
+
+func TestListPagesStopsAtMaxPages(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+	requests := 0
+	fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		writer.Header().Set(pageCountHeader, "10")
+		writer.Write(keysPage(requests))
+	})
+
+	pages := 0
+	err := ListPages(context.Background(), keysPath, nil, 2, func(page json.RawMessage) error {
+		pages++
+		return nil
+	})
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), fmt.Sprintf("%s has more than 2 pages", keysPath))
+	}
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, 2, requests)
+
+	// ListAll returns nothing rather than the partial list.
+	keys, err := ListAll[testKey](context.Background(), keysPath, nil, "keys", 2)
+	assert.Error(t, err)
+	assert.Nil(t, keys)
+}
+
+func TestListAllMissingField(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+	fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(`{"project_id":"4583214661dc12ab0c5b97.46071196"}`))
+	})
+
+	keys, err := ListAll[testKey](context.Background(), keysPath, nil, "keys", DefaultMaxPages)
+
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,93 @@
+package lokalise
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+)
+
+const (
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// RateLimitWarnThreshold is the number of requests left in the Lokalise API
+// rate limit window below which each call is logged at warn.
+var RateLimitWarnThreshold = 10
+
+// RateLimit is the state of the Lokalise API rate limit reported by a
+// response.
+type RateLimit struct {
+	// Limit is the number of requests allowed in the window, and Remaining
+	// the number left.
+	Limit     int
+	Remaining int
+
+	// Reset is when the window resets, or zero if it wasn't reported.
+	Reset time.Time
+
+	// ObservedAt is when the response was received.
+	ObservedAt time.Time
+}
+
+var (
+	latestRateLimitMutex sync.RWMutex
+	latestRateLimit      *RateLimit
+)
+
+// LatestRateLimit returns the rate limit reported by the last Lokalise API
+// response that had the rate limit headers, and false if none had them yet.
+func LatestRateLimit() (RateLimit, bool) {
+	latestRateLimitMutex.RLock()
+	defer latestRateLimitMutex.RUnlock()
+
+	if latestRateLimit == nil {
+		return RateLimit{}, false
+	}
+	return *latestRateLimit, true
+}
+
+// observeRateLimit records the rate limit headers of a response from the
+// Lokalise API, logging them at debug, or at warn if few requests are left.
+// Responses from other hosts, or without the headers, are ignored.
+func observeRateLimit(ctx context.Context, request *http.Request, response *http.Response) {
+	if base, err := url.Parse(lokaliseURL); err != nil || request.URL.Host != base.Host {
+		return
+	}
+
+	limit, err := strconv.Atoi(response.Header.Get(rateLimitLimitHeader))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(response.Header.Get(rateLimitRemainingHeader))
+	if err != nil {
+		return
+	}
+
+	rateLimit := &RateLimit{Limit: limit, Remaining: remaining, ObservedAt: time.Now()}
+	args := logging.Args{
+		"path":      request.URL.Path,
+		"limit":     logging.Int(limit),
+		"remaining": logging.Int(remaining),
+	}
+	if reset, err := strconv.ParseInt(response.Header.Get(rateLimitResetHeader), 10, 64); err == nil {
+		rateLimit.Reset = time.Unix(reset, 0)
+		args["reset"] = logging.TimeUTC(rateLimit.Reset)
+	}
+
+	latestRateLimitMutex.Lock()
+	latestRateLimit = rateLimit
+	latestRateLimitMutex.Unlock()
+
+	logger := logging.Debug()
+	if remaining < RateLimitWarnThreshold {
+		logger = logging.Warn()
+	}
+	logger.WithContext(ctx).LogArgs("{{.remaining}} of {{.limit}} Lokalise API requests left", args)
+}
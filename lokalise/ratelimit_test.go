@@ -0,0 +1,97 @@
+package lokalise
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// resetRateLimit forgets the rate limit observed, until the test ends.
+func resetRateLimit(t *testing.T) {
+	latestRateLimitMutex.Lock()
+	previous := latestRateLimit
+	latestRateLimit = nil
+	latestRateLimitMutex.Unlock()
+
+	t.Cleanup(func() {
+		latestRateLimitMutex.Lock()
+		latestRateLimit = previous
+		latestRateLimitMutex.Unlock()
+	})
+}
+
+func TestObserveRateLimit(t *testing.T) {
+	resetRateLimit(t)
+	logs, restore := logtest.Capture()
+	defer restore()
+	var remaining atomic.Int32
+	remaining.Store(120)
+	fakeLokaliseAPI(t, func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set(rateLimitLimitHeader, "6000")
+		writer.Header().Set(rateLimitRemainingHeader, strconv.Itoa(int(remaining.Load())))
+		writer.Header().Set(rateLimitResetHeader, "1709296200")
+		writer.Write([]byte(`{}`))
+	})
+
+	_, ok := LatestRateLimit()
+	assert.False(t, ok)
+
+	start := time.Now()
+	assert.NoError(t, callLokaliseAPI(context.Background(), http.MethodGet, lokaliseProjectsAPI, nil, nil))
+	rateLimit, ok := LatestRateLimit()
+	if assert.True(t, ok) {
+		assert.Equal(t, 6000, rateLimit.Limit)
+		assert.Equal(t, 120, rateLimit.Remaining)
+		assert.Equal(t, time.Unix(1709296200, 0), rateLimit.Reset)
+		assert.False(t, rateLimit.ObservedAt.Before(start))
+	}
+
+	// Few requests left is logged at warn.
+	remaining.Store(3)
+	assert.NoError(t, callLokaliseAPI(context.Background(), http.MethodGet, lokaliseProjectsAPI, nil, nil))
+	rateLimit, _ = LatestRateLimit()
+	assert.Equal(t, 3, rateLimit.Remaining)
+	var warned bool
+	for _, entry := range logs.Entries() {
+		if entry["level"] == "warn" && entry["msg"] == "3 of 6000 Lokalise API requests left" {
+			warned = true
+		}
+	}
+	assert.True(t, warned)
+}
+
+func TestObserveRateLimitIgnoresOtherHosts(t *testing.T) {
+	resetRateLimit(t)
+	_, restore := logtest.Capture()
+	defer restore()
+	previous := lokaliseURL
+	lokaliseURL = "https://api.lokalise.com"
+	defer func() { lokaliseURL = previous }()
+
+	response := &http.Response{Header: http.Header{}}
+	response.Header.Set(rateLimitLimitHeader, "6000")
+	response.Header.Set(rateLimitRemainingHeader, "120")
+
+	// The Lokalise URL is a prefix of these URLs, but not of their hosts.
+	for _, target := range []string{"https://api.lokalise.com.evil/api2/projects", "https://api.lokalise.com:8443/api2/projects"} {
+		observeRateLimit(context.Background(), httptest.NewRequest(http.MethodGet, target, nil), response)
+		_, ok := LatestRateLimit()
+		assert.False(t, ok, target)
+	}
+
+	// Responses without the headers are ignored too.
+	observeRateLimit(context.Background(), httptest.NewRequest(http.MethodGet, lokaliseURL+lokaliseProjectsAPI, nil), &http.Response{Header: http.Header{}})
+	_, ok := LatestRateLimit()
+	assert.False(t, ok)
+
+	observeRateLimit(context.Background(), httptest.NewRequest(http.MethodGet, lokaliseURL+lokaliseProjectsAPI, nil), response)
+	_, ok = LatestRateLimit()
+	assert.True(t, ok)
+}
@@ -0,0 +1,122 @@
+package lokalise
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+// defaultRecentEvents is the number of processed events RecentEvents keeps,
+// which is also the most RecentHandler returns.
+const defaultRecentEvents = 100
+
+// RecentEvent describes an event that was processed.
+type RecentEvent struct {
+	Event       string    `json:"event"`
+	ProjectID   string    `json:"project_id"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Outcome     string    `json:"outcome"`
+	LatencyMS   int64     `json:"latency_ms"`
+}
+
+// EventHistory keeps the most recently processed events in memory, evicting
+// the oldest beyond its size.
+type EventHistory struct {
+	mutex  sync.Mutex
+	events []RecentEvent
+	next   int
+	full   bool
+}
+
+// RecentEvents records the events processed by any router or worker pool.
+var RecentEvents = NewEventHistory(defaultRecentEvents)
+
+// NewEventHistory returns an empty history keeping up to size events.
+func NewEventHistory(size int) *EventHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &EventHistory{events: make([]RecentEvent, size)}
+}
+
+// Add records a processed event, evicting the oldest one if the history is
+// full.
+func (history *EventHistory) Add(event RecentEvent) {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	history.events[history.next] = event
+	history.next = (history.next + 1) % len(history.events)
+	if history.next == 0 {
+		history.full = true
+	}
+}
+
+// Last returns up to n of the events recorded, the most recent first, or
+// none if n is 0 or less.
+func (history *EventHistory) Last(n int) []RecentEvent {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	count := history.next
+	if history.full {
+		count = len(history.events)
+	}
+	if n > count {
+		n = count
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	last := make([]RecentEvent, 0, n)
+	for i := 1; i <= n; i++ {
+		last = append(last, history.events[(history.next-i+len(history.events))%len(history.events)])
+	}
+	return last
+}
+
+// RecentHandler responds with the last events recorded in history as a JSON
+// list, the most recent first, up to the number in the "n" query parameter
+// and at most 100. Requests must carry adminToken as a bearer token, like
+// replays.
+func RecentHandler(history *EventHistory, adminToken string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !authorizeAdmin(writer, request, adminToken, "recent events request") {
+			return
+		}
+
+		n := defaultRecentEvents
+		if value := request.URL.Query().Get("n"); len(value) > 0 {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				http.Error(writer, "invalid n", http.StatusBadRequest)
+				return
+			}
+			if parsed < n {
+				n = parsed
+			}
+		}
+
+		events := history.Last(n)
+		dataBytes, err := json.Marshal(events)
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			logging.Error().WithContext(request.Context()).LogErr("failed to marshal recent events", err)
+			return
+		}
+
+		logging.Debug().WithContext(request.Context()).LogArgs("served {{.count}} recent events to {{.remote_addr}}",
+			logging.Args{
+				"count":       logging.Int(len(events)),
+				"remote_addr": request.RemoteAddr,
+			})
+		writer.Header().Set(utils.ContentTypeHeader, "application/json")
+		writer.Write(dataBytes)
+	})
+}
@@ -0,0 +1,98 @@
+package lokalise
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// historyOf returns a history of size holding events "1" to "added".
+func historyOf(size, added int) *EventHistory {
+	history := NewEventHistory(size)
+	for i := 1; i <= added; i++ {
+		history.Add(RecentEvent{Event: strconv.Itoa(i)})
+	}
+	return history
+}
+
+func eventNames(events []RecentEvent) []string {
+	names := []string{}
+	for _, event := range events {
+		names = append(names, event.Event)
+	}
+	return names
+}
+
+func TestEventHistoryLast(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		size, added int
+		n           int
+		expected    []string
+	}{
+		{name: "empty", size: 3, added: 0, n: 3, expected: []string{}},
+		{name: "partly full", size: 3, added: 2, n: 3, expected: []string{"2", "1"}},
+		{name: "fewer than recorded", size: 3, added: 2, n: 1, expected: []string{"2"}},
+		{name: "exactly full", size: 3, added: 3, n: 3, expected: []string{"3", "2", "1"}},
+		{name: "wrapped around", size: 3, added: 5, n: 3, expected: []string{"5", "4", "3"}},
+		{name: "wrapped around twice", size: 3, added: 7, n: 2, expected: []string{"7", "6"}},
+		{name: "more than size", size: 3, added: 5, n: 10, expected: []string{"5", "4", "3"}},
+		{name: "zero", size: 3, added: 2, n: 0, expected: []string{}},
+		{name: "negative", size: 3, added: 2, n: -1, expected: []string{}},
+		{name: "size below 1 keeps one", size: 0, added: 2, n: 3, expected: []string{"2"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			history := historyOf(test.size, test.added)
+			assert.Equal(t, test.expected, eventNames(history.Last(test.n)))
+		})
+	}
+}
+
+func TestRecentHandler(t *testing.T) {
+	server := NewTestServer(t)
+	handler := RecentHandler(historyOf(defaultRecentEvents, defaultRecentEvents+5), testAdminToken)
+
+	get := func(query, authorization string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/lokalise/recent"+query, nil)
+		request.Header.Set("Authorization", authorization)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for _, test := range []struct {
+		query    string
+		expected int
+	}{
+		{"", defaultRecentEvents},
+		{"?n=2", 2},
+		{"?n=0", 0},
+		{"?n=1000", defaultRecentEvents},
+	} {
+		response := get(test.query, "Bearer "+testAdminToken)
+		if assert.Equal(t, http.StatusOK, response.Code, test.query) {
+			assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+			var events []RecentEvent
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &events))
+			if assert.Len(t, events, test.expected, test.query) && test.expected > 0 {
+				assert.Equal(t, strconv.Itoa(defaultRecentEvents+5), events[0].Event)
+			}
+		}
+	}
+
+	for _, query := range []string{"?n=-1", "?n=many"} {
+		assert.Equal(t, http.StatusBadRequest, get(query, "Bearer "+testAdminToken).Code, query)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("", "Bearer wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("", testAdminToken).Code)
+	assert.True(t, server.hasLogLine("warn", "rejected recent events request with an invalid admin token"))
+
+	response := httptest.NewRecorder()
+	RecentHandler(historyOf(1, 1), "").ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/lokalise/recent", nil))
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
@@ -0,0 +1,88 @@
+package lokalise
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/limitz404/lokalise-listener/logging"
+)
+
+// ReplayHandler reprocesses a webhook event captured earlier, given as the
+// raw payload in the request body or as the ID of a payload saved by the
+// router's PayloadStore in the "id" query parameter, through router, e.g.
+// once a bug in its handler is fixed. Replays are processed even if the
+// event was processed recently. Requests must carry adminToken as a bearer
+// token, and get a 401 otherwise, or a 404 if no admin token is configured.
+func ReplayHandler(router *EventRouter, adminToken string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		args := logging.Args{"remote_addr": request.RemoteAddr}
+
+		if !authorizeAdmin(writer, request, adminToken, "replay") {
+			return
+		}
+
+		router.mutex.RLock()
+		strict := router.strict
+		store := router.store
+		router.mutex.RUnlock()
+
+		var body io.Reader = request.Body
+		if id := request.URL.Query().Get("id"); len(id) > 0 {
+			args["capture_id"] = id
+			if store == nil {
+				http.NotFound(writer, request)
+				logging.Warn().WithContext(ctx).LogArgs("rejected replay of payload {{.capture_id}} with no payload store configured", args)
+				return
+			}
+
+			captured, err := store.Load(id)
+			if err != nil {
+				http.NotFound(writer, request)
+				logging.Error().WithContext(ctx).LogErrArgs("failed to load payload {{.capture_id}} to replay", err, args)
+				return
+			}
+			body = strings.NewReader(captured.Body)
+		}
+
+		event, err := decodeLokaliseEvent(body, strict)
+		if err := request.Body.Close(); err != nil {
+			logging.Error().WithContext(ctx).LogErr("failed to close request body", err)
+		}
+
+		if err != nil {
+			http.Error(writer, "malformed event", http.StatusBadRequest)
+			logging.Error().WithContext(ctx).LogErrArgs("failed to decode replayed webhook event", err, args)
+			return
+		}
+
+		args["event"] = event.Event
+		args["project_id"] = event.Project.ID
+		logging.Info().WithContext(ctx).LogArgs("replaying webhook event {{.event}} of project {{.project_id}} for {{.remote_addr}}", args)
+		router.dispatch(ctx, writer, event, true)
+	})
+}
+
+// authorizeAdmin reports whether request carries adminToken as a bearer
+// token, responding with a 401 if it doesn't, or a 404 if no admin token is
+// configured. action names the request in the log lines, e.g. "replay".
+func authorizeAdmin(writer http.ResponseWriter, request *http.Request, adminToken, action string) bool {
+	args := logging.Args{"action": action, "remote_addr": request.RemoteAddr}
+
+	if len(adminToken) == 0 {
+		http.NotFound(writer, request)
+		logging.Warn().WithContext(request.Context()).LogArgs("rejected {{.action}} with no admin token configured", args)
+		return false
+	}
+
+	authorization := request.Header.Get("Authorization")
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if !strings.HasPrefix(authorization, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		logging.Warn().WithContext(request.Context()).LogArgs("rejected {{.action}} with an invalid admin token", args)
+		return false
+	}
+	return true
+}
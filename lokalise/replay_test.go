@@ -0,0 +1,114 @@
+package lokalise
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "test-admin-token"
+
+// replay sends a replay request with the given Authorization header, payload
+// as the body and id as the query parameter if not empty.
+func replay(handler http.Handler, authorization string, payload []byte, id string) *httptest.ResponseRecorder {
+	target := "/api/v1/lokalise/replay"
+	if len(id) > 0 {
+		target += "?id=" + id
+	}
+	request := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if len(authorization) > 0 {
+		request.Header.Set("Authorization", authorization)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestReplayHandlerAuthorization(t *testing.T) {
+	server := NewTestServer(t)
+	payload := eventFixture(t, "project.imported")
+
+	// Without an admin token the endpoint doesn't exist.
+	response := replay(ReplayHandler(server.Router, ""), "Bearer "+testAdminToken, payload, "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.True(t, server.hasLogLine("warn", "rejected replay with no admin token configured"))
+
+	handler := ReplayHandler(server.Router, testAdminToken)
+	for _, authorization := range []string{"", "Bearer wrong", testAdminToken, "Basic " + testAdminToken, "bearer " + testAdminToken} {
+		response := replay(handler, authorization, payload, "")
+		assert.Equal(t, http.StatusUnauthorized, response.Code, authorization)
+	}
+	assert.True(t, server.hasLogLine("warn", "rejected replay with an invalid admin token"))
+}
+
+func TestReplayHandlerUnknownPayload(t *testing.T) {
+	server := NewTestServer(t)
+	handler := ReplayHandler(server.Router, testAdminToken)
+
+	// No payload store is configured.
+	response := replay(handler, "Bearer "+testAdminToken, nil, "20240301T120000.000000000-1")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	store, err := NewPayloadStore(t.TempDir(), 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	server.Router.SetPayloadStore(store)
+	for _, id := range []string{"20240301T120000.000000000-1", "../payloads"} {
+		response := replay(handler, "Bearer "+testAdminToken, nil, id)
+		assert.Equal(t, http.StatusNotFound, response.Code, id)
+	}
+	assert.True(t, server.hasLogLine("error", "failed to load payload 20240301T120000.000000000-1 to replay"))
+}
+
+func TestReplayHandlerBypassesDeduplication(t *testing.T) {
+	server := NewTestServer(t)
+	calls := 0
+	server.Router.AddHandler("project.imported", func(ctx context.Context, event *LokaliseEvent) error {
+		calls++
+		return nil
+	})
+	handler := ReplayHandler(server.Router, testAdminToken)
+	payload := eventFixture(t, "project.imported")
+
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.imported").StatusCode)
+	assert.Equal(t, 1, calls)
+
+	// The event was processed already, but replays are processed again.
+	response := replay(handler, "Bearer "+testAdminToken, payload, "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 2, calls)
+	assert.True(t, server.hasLogLine("info", "replaying webhook event project.imported of project 4583214661dc12ab0c5b97.46071196 for 192.0.2.1:1234"))
+
+	// Likewise from a saved payload.
+	store, err := NewPayloadStore(t.TempDir(), 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	server.Router.SetPayloadStore(store)
+	id, err := store.Save(CapturedPayload{ReceivedAt: time.Now(), Body: string(payload), Decision: "processed"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	response = replay(handler, "Bearer "+testAdminToken, nil, id)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 3, calls)
+
+	// Redeliveries are still ignored after a replay.
+	assert.Equal(t, http.StatusOK, server.postEvent(t, "project.imported").StatusCode)
+	assert.Equal(t, 3, calls)
+}
+
+func TestReplayHandlerMalformedEvent(t *testing.T) {
+	server := NewTestServer(t)
+
+	response := replay(ReplayHandler(server.Router, testAdminToken), "Bearer "+testAdminToken, []byte("{"), "")
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.True(t, server.hasLogLine("error", "failed to decode replayed webhook event"))
+}
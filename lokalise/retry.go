@@ -0,0 +1,149 @@
+package lokalise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+// RetryPolicy determines how calls to the Lokalise API are retried after a
+// 429, a 5xx or a network error.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	MaxAttempts int
+
+	// Deadline bounds the total time spent on a call, including the waits
+	// between attempts.
+	Deadline time.Duration
+
+	// BaseDelay is the wait before the first retry. It doubles with each
+	// retry, up to MaxDelay, with jitter added. A Retry-After header on a
+	// 429 takes precedence.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// APIRetryPolicy is the policy applied to calls to the Lokalise API.
+var APIRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Deadline:    30 * time.Second,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    8 * time.Second,
+}
+
+// doWithRetry sends the request built by newRequest until it succeeds, fails
+// with a status that isn't worth retrying, or the policy gives up. New
+// requests are built for each attempt so that their bodies can be sent
+// again. The caller must close the body of the returned response.
+func doWithRetry(ctx context.Context, client *http.Client, policy RetryPolicy, newRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, policy.Deadline)
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			cancel()
+		}
+	}()
+
+	delay := policy.BaseDelay
+	for attempt := 1; ; attempt++ {
+		request, err := newRequest(ctx)
+		if err != nil {
+			return nil, utils.WrapError(err)
+		}
+
+		response, err := client.Do(request)
+		if err != nil && ctx.Err() != nil {
+			// Cancellations are logged by the caller, not retried.
+			return nil, utils.WrapError(err)
+		}
+
+		args := logging.Args{
+			"attempt": logging.Int(attempt),
+			"path":    request.URL.Path,
+		}
+
+		var wait time.Duration
+		if err == nil {
+			observeRateLimit(ctx, request, response)
+			if !isRetryableStatus(response.StatusCode) {
+				// The body is read after returning, so the deadline is only
+				// cancelled once it is closed.
+				response.Body = cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+				handedOff = true
+				return response, nil
+			}
+
+			args["status"] = logging.HTTPStatus(response.StatusCode)
+			wait = retryAfter(response)
+			response.Body.Close()
+			err = fmt.Errorf("unexpected status: %s", response.Status)
+		}
+
+		if wait == 0 {
+			wait = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		}
+		if delay *= 2; delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+
+		deadline, _ := ctx.Deadline()
+		if attempt >= policy.MaxAttempts || time.Until(deadline) < wait {
+			return nil, utils.WrapError(logging.Error().LogReturnErrArgs("giving up on Lokalise API call after {{.attempt}} attempts", err, args))
+		}
+
+		args["delay"] = logging.Duration(wait)
+		logging.Warn().LogErrArgs("retrying Lokalise API call in {{.delay}} after attempt {{.attempt}} failed", err, args)
+
+		select {
+		case <-ctx.Done():
+			return nil, utils.WrapError(errors.Join(err, ctx.Err()))
+		case <-time.After(wait):
+		}
+	}
+}
+
+// cancelOnClose is a response body that cancels the context of its request
+// when it is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// isRetryableStatus reports whether a response with the given status may
+// succeed if the request is sent again.
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryAfter returns the wait requested by the Retry-After header of a 429
+// response, either in seconds or as a date, or zero if there is none.
+func retryAfter(response *http.Response) time.Duration {
+	if response.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+
+	value := response.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+package lokalise
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRetryPolicy retries quickly, so that the tests don't wait.
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Deadline:    5 * time.Second,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    40 * time.Millisecond,
+}
+
+// statusServer answers the requests it receives with statuses in turn,
+// repeating the last one, recording when each request arrived.
+type statusServer struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	arrivals []time.Time
+}
+
+func newStatusServer(t *testing.T, header http.Header, statuses ...int) *statusServer {
+	t.Helper()
+
+	server := &statusServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		attempt := len(server.arrivals)
+		server.arrivals = append(server.arrivals, time.Now())
+		server.mutex.Unlock()
+
+		status := statuses[len(statuses)-1]
+		if attempt < len(statuses) {
+			status = statuses[attempt]
+		}
+		for key, values := range header {
+			writer.Header()[key] = values
+		}
+		writer.WriteHeader(status)
+		writer.Write([]byte("body"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *statusServer) attempts() []time.Time {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]time.Time(nil), server.arrivals...)
+}
+
+func (server *statusServer) newRequest(ctx context.Context) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api2/projects", nil)
+}
+
+func TestDoWithRetrySucceedsAfter5xx(t *testing.T) {
+	server := newStatusServer(t, nil, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+	logs, restore := logtest.Capture()
+	defer restore()
+
+	response, err := doWithRetry(context.Background(), server.Client(), testRetryPolicy, server.newRequest)
+
+	if assert.NoError(t, err) {
+		// The body is still readable with the retry deadline in place.
+		body, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "body", string(body))
+		response.Body.Close()
+	}
+	attempts := server.attempts()
+	if assert.Len(t, attempts, 3) {
+		// The first retry waits at least half the base delay, the second
+		// half of twice that.
+		assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), testRetryPolicy.BaseDelay/2)
+		assert.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), testRetryPolicy.BaseDelay)
+	}
+
+	var retries []map[string]string
+	for _, entry := range logs.Entries() {
+		if entry["level"] == "warn" {
+			retries = append(retries, entry)
+		}
+	}
+	if assert.Len(t, retries, 2) {
+		assert.Equal(t, "503 Service Unavailable", retries[0]["arg_status"])
+		assert.Equal(t, "502 Bad Gateway", retries[1]["arg_status"])
+	}
+}
+
+func TestDoWithRetryHonorsRetryAfter(t *testing.T) {
+	server := newStatusServer(t, http.Header{"Retry-After": {"1"}}, http.StatusTooManyRequests, http.StatusOK)
+	_, restore := logtest.Capture()
+	defer restore()
+
+	response, err := doWithRetry(context.Background(), server.Client(), testRetryPolicy, server.newRequest)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		response.Body.Close()
+	}
+	attempts := server.attempts()
+	if assert.Len(t, attempts, 2) {
+		assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), time.Second)
+	}
+}
+
+func TestDoWithRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	server := newStatusServer(t, nil, http.StatusInternalServerError)
+	logs, restore := logtest.Capture()
+	defer restore()
+
+	response, err := doWithRetry(context.Background(), server.Client(), testRetryPolicy, server.newRequest)
+
+	assert.Error(t, err)
+	assert.Nil(t, response)
+	assert.Len(t, server.attempts(), testRetryPolicy.MaxAttempts)
+	entries := logs.Entries()
+	if assert.NotEmpty(t, entries) {
+		last := entries[len(entries)-1]
+		assert.Equal(t, "error", last["level"])
+		assert.Equal(t, "giving up on Lokalise API call after 3 attempts", last["msg"])
+	}
+}
+
+func TestDoWithRetryDoesNotRetryClientErrors(t *testing.T) {
+	server := newStatusServer(t, nil, http.StatusNotFound)
+
+	response, err := doWithRetry(context.Background(), server.Client(), testRetryPolicy, server.newRequest)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		response.Body.Close()
+	}
+	assert.Len(t, server.attempts(), 1)
+}
+
+func TestDoWithRetryGivesUpBeforeDeadline(t *testing.T) {
+	server := newStatusServer(t, http.Header{"Retry-After": {"10"}}, http.StatusTooManyRequests)
+	_, restore := logtest.Capture()
+	defer restore()
+	policy := testRetryPolicy
+	policy.Deadline = time.Second
+
+	start := time.Now()
+	_, err := doWithRetry(context.Background(), server.Client(), policy, server.newRequest)
+
+	// Waiting 10s would overrun the deadline, so there is no second attempt.
+	assert.Error(t, err)
+	assert.Len(t, server.attempts(), 1)
+	assert.Less(t, time.Since(start), policy.Deadline)
+}
+
+func TestDoWithRetryStopsWhenCancelled(t *testing.T) {
+	server := newStatusServer(t, http.Header{"Retry-After": {"10"}}, http.StatusTooManyRequests)
+	logs, restore := logtest.Capture()
+	defer restore()
+	policy := testRetryPolicy
+	policy.Deadline = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := doWithRetry(ctx, server.Client(), policy, server.newRequest)
+
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Len(t, server.attempts(), 1)
+
+	// A call cancelled before it starts isn't retried or logged as given up.
+	_, err = doWithRetry(ctx, server.Client(), policy, server.newRequest)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Len(t, server.attempts(), 1)
+	for _, entry := range logs.Entries() {
+		assert.NotEqual(t, "error", entry["level"], entry["msg"])
+	}
+}
+
+// countingTransport is an http.RoundTripper counting the requests it sends.
+type countingTransport struct {
+	mutex sync.Mutex
+	count int
+}
+
+func (transport *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.mutex.Lock()
+	transport.count++
+	transport.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestDoWithRetryUsesClient(t *testing.T) {
+	server := newStatusServer(t, nil, http.StatusServiceUnavailable, http.StatusOK)
+	_, restore := logtest.Capture()
+	defer restore()
+	transport := &countingTransport{}
+
+	response, err := doWithRetry(context.Background(), &http.Client{Transport: transport}, testRetryPolicy, server.newRequest)
+
+	if assert.NoError(t, err) {
+		response.Body.Close()
+	}
+	assert.Equal(t, 2, transport.count)
+}
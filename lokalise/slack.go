@@ -0,0 +1,137 @@
+package lokalise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+// SlackNotifier posts a message about webhook events to a Slack incoming
+// webhook. Register its Notify method for the events that should notify.
+type SlackNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewSlackNotifier returns a notifier posting to the Slack incoming webhook
+// at webhookURL.
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{webhookURL: webhookURL, client: HTTPClient}
+}
+
+// Notify posts a message about event to Slack, retrying transient failures.
+// The outcome is logged, but it never returns an error, since a failure to
+// notify shouldn't make Lokalise send the event again.
+func (notifier *SlackNotifier) Notify(ctx context.Context, event *LokaliseEvent) error {
+	args := logging.Args{
+		"event":      event.Event,
+		"project_id": event.Project.ID,
+	}
+
+	message := slackMessage(event)
+	if skippedInDryRun("notifying Slack", logging.Args{
+		"event":      event.Event,
+		"project_id": event.Project.ID,
+		"message":    message,
+	}) {
+		return nil
+	}
+
+	err := notifier.post(ctx, message)
+	auditAction("sent a Slack notification", event, nil, err)
+	if err != nil {
+		logging.Error().LogErrArgs("failed to notify Slack of webhook event {{.event}}", err, args)
+		return nil
+	}
+
+	logging.Info().LogArgs("notified Slack of webhook event {{.event}}", args)
+	return nil
+}
+
+// post sends text to the Slack webhook.
+func (notifier *SlackNotifier) post(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return utils.WrapError(err)
+	}
+
+	response, err := doWithRetry(ctx, notifier.client, APIRetryPolicy, func(ctx context.Context) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.webhookURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, utils.WrapError(err)
+		}
+
+		request.Header.Set("content-type", "application/json")
+		return request, nil
+	})
+
+	if err != nil {
+		return utils.WrapError(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return utils.WrapError(fmt.Errorf("unexpected status from Slack: %s", response.Status))
+	}
+
+	return nil
+}
+
+// slackMessage formats a message naming the project and the event, followed
+// by the counts found in the payload, e.g. the keys inserted by an import.
+func slackMessage(event *LokaliseEvent) string {
+	name := event.Project.Name
+	if len(name) == 0 {
+		name = event.Project.ID
+	}
+
+	message := strings.Builder{}
+	fmt.Fprintf(&message, "*%s*: `%s`", name, event.Event)
+
+	if counts := payloadCounts(event.Payload); len(counts) > 0 {
+		message.WriteString("\n")
+		message.WriteString(strings.Join(counts, ", "))
+	}
+
+	return message.String()
+}
+
+// payloadCounts returns "name: count" pairs for the numbers in the objects of
+// an event payload, such as "import": {"inserted": 3}, other than IDs, and for
+// the lengths of its lists, such as "keys", sorted by name.
+func payloadCounts(payload json.RawMessage) []string {
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil
+	}
+
+	var counts []string
+	for name, value := range fields {
+		switch value := value.(type) {
+		case []interface{}:
+			counts = append(counts, fmt.Sprintf("%s: %d", name, len(value)))
+		case map[string]interface{}:
+			if name == "project" || name == "user" {
+				continue
+			}
+			for field, count := range value {
+				if field == "id" || strings.HasSuffix(field, "_id") {
+					continue
+				}
+				if count, ok := count.(float64); ok {
+					counts = append(counts, fmt.Sprintf("%s %s: %v", name, field, count))
+				}
+			}
+		}
+	}
+
+	sort.Strings(counts)
+	return counts
+}
@@ -0,0 +1,101 @@
+package lokalise
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadCounts(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		payload  string
+		expected []string
+	}{
+		{name: "malformed", payload: `{"import":`},
+		{name: "not an object", payload: `[1, 2]`},
+		{name: "no counts", payload: `{"event":"project.task.closed","task":{"id":1,"title":"Spring"},"created_at_timestamp":1709296200}`},
+		{
+			name:     "counts",
+			payload:  `{"event":"project.imported","import":{"inserted":12,"skipped":0,"task_id":3},"keys":[{},{}],"project":{"keys":4},"user":{"count":1}}`,
+			expected: []string{"import inserted: 12", "import skipped: 0", "keys: 2"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, payloadCounts(json.RawMessage(test.payload)))
+		})
+	}
+}
+
+func TestSlackMessage(t *testing.T) {
+	assert.Equal(t, "*Makeshift*: `project.imported`\nimport inserted: 12, import skipped: 0, import updated: 3",
+		slackMessage(decodedFixture(t, "project.imported")))
+
+	// Without a name, the project is named by its ID, and without counts the
+	// message is a single line.
+	event := decodedFixture(t, "project.task.closed")
+	event.Project.Name = ""
+	assert.Equal(t, "*4583214661dc12ab0c5b97.46071196*: `project.task.closed`", slackMessage(event))
+}
+
+func TestSlackNotifierNotify(t *testing.T) {
+	var text string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		message := map[string]string{}
+		json.Unmarshal(body, &message)
+		text = message["text"]
+		assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+	logs, restore := logtest.Capture()
+	defer restore()
+	event := decodedFixture(t, "project.imported")
+
+	assert.NoError(t, NewSlackNotifier(server.URL).Notify(context.Background(), event))
+
+	assert.Equal(t, slackMessage(event), text)
+	entries := auditEntries(logs)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "succeeded", entries[0]["arg_outcome"])
+	}
+}
+
+func TestSlackNotifierFailure(t *testing.T) {
+	previous := APIRetryPolicy
+	APIRetryPolicy = testRetryPolicy
+	defer func() { APIRetryPolicy = previous }()
+	for _, status := range []int{http.StatusForbidden, http.StatusInternalServerError, http.StatusCreated} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server := newStatusServer(t, nil, status)
+			logs, restore := logtest.Capture()
+			defer restore()
+			notifier := NewSlackNotifier(server.URL)
+			event := decodedFixture(t, "project.imported")
+
+			err := notifier.post(context.Background(), slackMessage(event))
+			assert.Error(t, err)
+
+			// Notify reports the error in the log and the audit trail rather
+			// than failing the event, so that Lokalise doesn't resend it.
+			assert.NoError(t, notifier.Notify(context.Background(), event))
+			var failed bool
+			for _, entry := range logs.Entries() {
+				if entry["level"] == "error" && entry["msg"] == "failed to notify Slack of webhook event project.imported" {
+					failed = true
+				}
+			}
+			assert.True(t, failed)
+			entries := auditEntries(logs)
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, "failed", entries[0]["arg_outcome"])
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package lokalise
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/limitz404/lokalise-listener/utils"
+)
+
+// testWebhookSecret is the webhook secret accepted by the test servers.
+const testWebhookSecret = "test-webhook-secret"
+
+// testServer serves webhooks to Router like the listener does, behind the
+// signature check, and captures the lines logged while it runs in Logs.
+type testServer struct {
+	*httptest.Server
+	Router *EventRouter
+	Logs   *logtest.Buffer
+}
+
+// NewTestServer starts a server with a router without any handlers, which
+// is closed, and whose log capture is stopped, when the test ends.
+func NewTestServer(t testing.TB) *testServer {
+	t.Helper()
+
+	logs, restore := logtest.Capture()
+	router := NewEventRouter()
+	handler := utils.LimitRequestBody(utils.DefaultMaxBodyBytes)(VerifyLokaliseSignature([]string{testWebhookSecret}, router))
+	server := httptest.NewServer(utils.LogRequestScope(handler))
+	t.Cleanup(func() {
+		server.Close()
+		restore()
+	})
+
+	return &testServer{Server: server, Router: router, Logs: logs}
+}
+
+// eventFixture returns the sample payload of the given event type in
+// testdata/events.
+func eventFixture(t testing.TB, event string) []byte {
+	t.Helper()
+
+	payload, err := os.ReadFile(filepath.Join("testdata", "events", event+".json"))
+	if err != nil {
+		t.Fatalf("no fixture for event %s: %v", event, err)
+	}
+	return payload
+}
+
+// postEvent posts the sample payload of the given event type with the
+// webhook secret.
+func (server *testServer) postEvent(t testing.TB, event string) *http.Response {
+	t.Helper()
+	return server.postPayload(t, eventFixture(t, event), testWebhookSecret)
+}
+
+// postPayload posts payload as a webhook with secret.
+func (server *testServer) postPayload(t testing.TB, payload []byte, secret string) *http.Response {
+	t.Helper()
+	return server.do(t, server.newWebhookRequest(t, payload, secret))
+}
+
+// newWebhookRequest returns a webhook request posting payload with secret,
+// for tests that need to change it before it is sent with do.
+func (server *testServer) newWebhookRequest(t testing.TB, payload []byte, secret string) *http.Request {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set(utils.ContentTypeHeader, "application/json")
+	request.Header.Set(lokaliseWebhookSecretHeaderKey, secret)
+	return request
+}
+
+// do sends request to the server.
+func (server *testServer) do(t testing.TB, request *http.Request) *http.Response {
+	t.Helper()
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+// hasLogLine reports whether a line with the given level and message was
+// logged.
+func (server *testServer) hasLogLine(level, msg string) bool {
+	for _, entry := range server.Logs.Entries() {
+		if entry["level"] == level && entry["msg"] == msg {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeLokaliseAPI points the Lokalise API calls to a server running handler
+// until the test ends.
+func fakeLokaliseAPI(t testing.TB, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	previous := lokaliseURL
+	lokaliseURL = server.URL
+	t.Cleanup(func() {
+		lokaliseURL = previous
+		server.Close()
+	})
+	return server
+}
+
+// decodedFixture returns the sample event of the given type, decoded.
+func decodedFixture(t testing.TB, event string) *LokaliseEvent {
+	t.Helper()
+
+	decoded, err := DecodeLokaliseEvent(bytes.NewReader(eventFixture(t, event)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// auditEntries returns the audit lines captured in logs.
+func auditEntries(logs *logtest.Buffer) []map[string]string {
+	var entries []map[string]string
+	for _, entry := range logs.Entries() {
+		if entry[logging.AuditField] == "true" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -3,8 +3,11 @@ package lokalise
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strings"
@@ -14,26 +17,158 @@ import (
 )
 
 const (
-	lokaliseURL                    = "https://api.lokalise.com"
 	lokaliseProjectsAPI            = "/api2/projects"
 	lokaliseWebhookSecretHeaderKey = "x-secret"
 )
 
+// lokaliseURL is the base URL of the Lokalise API. Tests point it to a
+// local server.
+var lokaliseURL = "https://api.lokalise.com"
+
 var (
-	lokaliseWebhookSecret = os.Getenv("LOKALISE_WEBHOOK_SECRET")
-	readOnlyAPIToken      = os.Getenv("LOKALISE_READ_ONLY_API_TOKEN")
+	// WebhookSecrets are the secrets Lokalise may send with webhooks, the
+	// current one first, and the ones being rotated out after it.
+	WebhookSecrets = utils.SplitList(os.Getenv("LOKALISE_WEBHOOK_SECRET"))
+
+	// APIToken is the read-only token used to call the Lokalise API.
+	APIToken = os.Getenv("LOKALISE_READ_ONLY_API_TOKEN")
 )
 
-func validateLokaliseWebhookSecret(request *http.Request, secret string) error {
-	value := request.Header.Get(lokaliseWebhookSecretHeaderKey)
-	if value != secret {
-		return utils.WrapError(errors.New("unable to validate request"))
+// validateLokaliseWebhookSecret returns the index of the secret in secrets
+// that the request carries. Every secret is compared, so that the time taken
+// doesn't tell which one matched.
+func validateLokaliseWebhookSecret(request *http.Request, secrets []string) (int, error) {
+	if len(secrets) == 0 {
+		return -1, utils.WrapError(errors.New("no webhook secret configured"))
+	}
+
+	value := []byte(request.Header.Get(lokaliseWebhookSecretHeaderKey))
+	matched := -1
+	for i, secret := range secrets {
+		if len(secret) > 0 && subtle.ConstantTimeCompare(value, []byte(secret)) == 1 && matched < 0 {
+			matched = i
+		}
+	}
+	if matched < 0 {
+		return -1, utils.WrapError(errors.New("unable to validate request"))
+	}
+
+	return matched, nil
+}
+
+// peekProjectID returns the project ID of a webhook request body, if it has
+// one, leaving the body intact for the next handler.
+func peekProjectID(request *http.Request) string {
+	bodyJSON, err := utils.GetJSONBody(&request.Body)
+	if err != nil {
+		return ""
+	}
+
+	project, _ := bodyJSON["project"].(map[string]interface{})
+	projectID, _ := project["id"].(string)
+	return projectID
+}
+
+// ValidateAPIToken checks that the Lokalise API accepts the API token by
+// listing a single project.
+func ValidateAPIToken(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		lokaliseURL+lokaliseProjectsAPI+"?limit=1",
+		nil,
+	)
+
+	if err != nil {
+		return utils.WrapError(err)
+	}
+
+	request.Header.Set("x-api-token", APIToken)
+
+	response, err := HTTPClient.Do(request)
+	if err != nil {
+		return utils.WrapError(err)
+	}
+	response.Body.Close()
+	observeRateLimit(ctx, request, response)
+
+	if response.StatusCode != http.StatusOK {
+		return utils.WrapError(fmt.Errorf("unexpected status validating API token: %s", response.Status))
 	}
 
 	return nil
 }
 
-func createStringsPullRequest(projectID string) error {
+// callLokaliseAPI sends a request with the JSON encoding of body, if it isn't
+// nil, to the Lokalise API path, with retries, and decodes the JSON response
+// into result, if it isn't nil.
+func callLokaliseAPI(ctx context.Context, method, path string, body, result interface{}) error {
+	_, err := callLokaliseAPIHeader(ctx, method, path, body, result)
+	return err
+}
+
+// callLokaliseAPIHeader is callLokaliseAPI also returning the response
+// headers, e.g. for pagination.
+func callLokaliseAPIHeader(ctx context.Context, method, path string, body, result interface{}) (http.Header, error) {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return nil, utils.WrapError(err)
+		}
+	}
+
+	response, err := doWithRetry(ctx, HTTPClient, APIRetryPolicy, func(ctx context.Context) (*http.Request, error) {
+		var bodyReader io.Reader
+		if bodyBytes != nil {
+			bodyReader = bytes.NewReader(bodyBytes)
+		}
+
+		request, err := http.NewRequestWithContext(ctx, method, lokaliseURL+path, bodyReader)
+		if err != nil {
+			return nil, utils.WrapError(err)
+		}
+
+		if bodyBytes != nil {
+			request.Header.Set("content-type", "application/json")
+		}
+		request.Header.Set("x-api-token", APIToken)
+
+		if utils.VerboseLogging {
+			utils.LogOutgoingRequest(request)
+		}
+
+		return request, nil
+	})
+
+	if err != nil {
+		return nil, utils.WrapError(err)
+	}
+	defer response.Body.Close()
+
+	if utils.VerboseLogging {
+		if err := utils.LogResponse(response); err != nil {
+			return nil, utils.WrapError(err)
+		}
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, utils.WrapError(fmt.Errorf("unexpected status from %s %s: %s", method, path, response.Status))
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+			return nil, utils.WrapError(err)
+		}
+	}
+
+	return response.Header, nil
+}
+
+func createStringsPullRequest(ctx context.Context, projectID string) error {
 	urlBuilder := strings.Builder{}
 	urlBuilder.WriteString(lokaliseURL)
 	urlBuilder.WriteString(lokaliseProjectsAPI)
@@ -51,32 +186,32 @@ func createStringsPullRequest(projectID string) error {
 		return utils.WrapError(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	response, err := doWithRetry(ctx, HTTPClient, APIRetryPolicy, func(ctx context.Context) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			urlBuilder.String(),
+			bytes.NewReader(dataBytes),
+		)
 
-	request, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		urlBuilder.String(),
-		bytes.NewBuffer(dataBytes),
-	)
+		if err != nil {
+			return nil, utils.WrapError(err)
+		}
 
-	if err != nil {
-		return utils.WrapError(err)
-	}
+		request.Header.Set("content-type", "application/json")
+		request.Header.Set("x-api-token", APIToken)
 
-	request.Header.Set("content-type", "application/json")
-	request.Header.Set("x-api-token", readOnlyAPIToken)
+		if utils.VerboseLogging {
+			utils.LogOutgoingRequest(request)
+		}
 
-	if utils.VerboseLogging {
-		utils.LogOutgoingRequest(request)
-	}
+		return request, nil
+	})
 
-	client := &http.Client{}
-	response, err := client.Do(request)
 	if err != nil {
 		return utils.WrapError(err)
 	}
+	defer response.Body.Close()
 
 	if utils.VerboseLogging {
 		if err := utils.LogResponse(response); err != nil {
@@ -84,5 +219,9 @@ func createStringsPullRequest(projectID string) error {
 		}
 	}
 
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return utils.WrapError(fmt.Errorf("unexpected status triggering a strings pull request for %s: %s", projectID, response.Status))
+	}
+
 	return nil
 }
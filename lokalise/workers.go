@@ -0,0 +1,211 @@
+package lokalise
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+)
+
+// queueDepthLogInterval is the time between the lines reporting the number
+// of queued events.
+const queueDepthLogInterval = time.Minute
+
+// ErrQueueFull is returned by WorkerPool.Enqueue when the queue stays full
+// for longer than the pool's enqueue timeout.
+var ErrQueueFull = errors.New("event queue is full")
+
+// ErrPoolClosed is returned by WorkerPool.Enqueue once the pool is closed.
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+// WorkerPool processes webhook events in the background with a fixed number
+// of goroutines, so that webhooks can be acknowledged before the heavy work
+// is done and Lokalise doesn't time out and send them again.
+type WorkerPool struct {
+	queue          chan queuedEvent
+	enqueueTimeout time.Duration
+	eventTimeout   time.Duration
+
+	// ctx is cancelled to stop the events being processed, see Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	workers sync.WaitGroup
+	done    chan struct{}
+
+	// mutex guards closed, and is held by Enqueue while sending, so that
+	// the queue is never sent to once closed.
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// queuedEvent is an event waiting for a worker, with the context of the
+// request it arrived with so that its log lines carry the request fields.
+type queuedEvent struct {
+	ctx     context.Context
+	event   *LokaliseEvent
+	handler EventHandler
+}
+
+// NewWorkerPool starts workers goroutines processing events from a queue
+// holding up to queueSize events. When the queue is full, Enqueue waits up
+// to enqueueTimeout for room, or fails straight away if it is 0. Processing
+// an event is cancelled after eventTimeout.
+func NewWorkerPool(workers, queueSize int, enqueueTimeout, eventTimeout time.Duration) *WorkerPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := &WorkerPool{
+		queue:          make(chan queuedEvent, queueSize),
+		enqueueTimeout: enqueueTimeout,
+		eventTimeout:   eventTimeout,
+		ctx:            ctx,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+
+	pool.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	go pool.logDepth()
+
+	return pool
+}
+
+// Enqueue queues event to be processed by handler, failing with ErrQueueFull
+// if there is no room for it in time, or ErrPoolClosed once the pool is
+// closed.
+func (pool *WorkerPool) Enqueue(ctx context.Context, event *LokaliseEvent, handler EventHandler) error {
+	queued := queuedEvent{ctx: context.WithoutCancel(ctx), event: event, handler: handler}
+
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	if pool.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case pool.queue <- queued:
+		eventQueueDepth.Inc()
+		return nil
+	default:
+	}
+
+	if pool.enqueueTimeout <= 0 {
+		return ErrQueueFull
+	}
+
+	timer := time.NewTimer(pool.enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case pool.queue <- queued:
+		eventQueueDepth.Inc()
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	}
+}
+
+// Depth returns the number of events waiting for a worker.
+func (pool *WorkerPool) Depth() int {
+	return len(pool.queue)
+}
+
+// Close stops accepting events and waits for the queued ones to be
+// processed. Once ctx is done, the events being processed are cancelled and
+// the queued ones are dropped, and ctx's error is returned when the workers
+// have stopped. Events enqueued after Close are rejected.
+func (pool *WorkerPool) Close(ctx context.Context) error {
+	pool.mutex.Lock()
+	if !pool.closed {
+		pool.closed = true
+		close(pool.done)
+		close(pool.queue)
+	}
+	pool.mutex.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		pool.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		pool.cancel()
+		return nil
+	case <-ctx.Done():
+		pool.cancel()
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+func (pool *WorkerPool) work() {
+	defer pool.workers.Done()
+	for queued := range pool.queue {
+		eventQueueDepth.Dec()
+		if pool.ctx.Err() != nil {
+			logging.Warn().WithContext(queued.ctx).LogArgs("dropped queued webhook event {{.event}} on shutdown",
+				logging.Args{
+					"event":      queued.event.Event,
+					"project_id": queued.event.Project.ID,
+				})
+			continue
+		}
+		pool.process(queued)
+	}
+}
+
+// process runs the handler of a queued event, logging its failure or panic,
+// since there is no longer a request to fail. The handler's context carries
+// the request's values, but is cancelled by the pool or after the event
+// timeout.
+func (pool *WorkerPool) process(queued queuedEvent) {
+	ctx, cancel := context.WithTimeout(queued.ctx, pool.eventTimeout)
+	defer cancel()
+	stop := context.AfterFunc(pool.ctx, cancel)
+	defer stop()
+
+	args := logging.Args{
+		"event":      queued.event.Event,
+		"project_id": queued.event.Project.ID,
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			args["panic"] = logging.Str(r)
+			args["stack"] = string(debug.Stack())
+			logging.Error().WithContext(queued.ctx).LogArgs("worker panicked processing webhook event {{.event}}: {{.panic}}", args)
+		}
+	}()
+
+	if err := observeEvent(ctx, queued.handler, queued.event); err != nil {
+		logProcessingError(queued.ctx, err, args)
+		return
+	}
+
+	logging.Info().WithContext(queued.ctx).LogArgs("processed webhook event {{.event}}", args)
+}
+
+// logDepth periodically logs the number of queued events until the pool is
+// closed.
+func (pool *WorkerPool) logDepth() {
+	ticker := time.NewTicker(queueDepthLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.done:
+			return
+		case <-ticker.C:
+			logging.Debug().LogArgs("{{.depth}} webhook events queued", logging.Args{
+				"depth":    logging.Int(pool.Depth()),
+				"capacity": logging.Int(cap(pool.queue)),
+			})
+		}
+	}
+}
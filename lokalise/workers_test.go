@@ -0,0 +1,182 @@
+package lokalise
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingHandler is an EventHandler that blocks until released or
+// cancelled, recording the events it finished.
+type blockingHandler struct {
+	started  chan struct{}
+	release  chan struct{}
+	mutex    sync.Mutex
+	finished []string
+	errs     []error
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (handler *blockingHandler) handle(ctx context.Context, event *LokaliseEvent) error {
+	handler.started <- struct{}{}
+	var err error
+	select {
+	case <-handler.release:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	handler.finished = append(handler.finished, event.Event)
+	handler.errs = append(handler.errs, err)
+	return err
+}
+
+func (handler *blockingHandler) results() ([]string, []error) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	return append([]string(nil), handler.finished...), append([]error(nil), handler.errs...)
+}
+
+func testEvent(name string) *LokaliseEvent {
+	return &LokaliseEvent{Event: name, Project: LokaliseProject{ID: "p1"}}
+}
+
+func TestWorkerPoolEnqueueTimeout(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+
+	handler := newBlockingHandler()
+	pool := NewWorkerPool(1, 1, 50*time.Millisecond, time.Minute)
+	defer func() {
+		close(handler.release)
+		pool.Close(context.Background())
+	}()
+
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("first"), handler.handle))
+	<-handler.started
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("queued"), handler.handle))
+	assert.Equal(t, 1, pool.Depth())
+
+	start := time.Now()
+	err := pool.Enqueue(context.Background(), testEvent("rejected"), handler.handle)
+	assert.Equal(t, ErrQueueFull, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestWorkerPoolEnqueueWaitsForRoom(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+
+	handler := newBlockingHandler()
+	pool := NewWorkerPool(1, 1, time.Second, time.Minute)
+	defer pool.Close(context.Background())
+
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("first"), handler.handle))
+	<-handler.started
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("second"), handler.handle))
+
+	// Releasing the first event makes room for the third while it waits.
+	time.AfterFunc(20*time.Millisecond, func() { close(handler.release) })
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("third"), handler.handle))
+}
+
+func TestWorkerPoolCloseDrainsQueue(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+
+	handler := newBlockingHandler()
+	close(handler.release)
+	pool := NewWorkerPool(1, 10, 0, time.Minute)
+	for _, name := range []string{"a", "b", "c"} {
+		assert.NoError(t, pool.Enqueue(context.Background(), testEvent(name), handler.handle))
+	}
+
+	assert.NoError(t, pool.Close(context.Background()))
+
+	finished, errs := handler.results()
+	assert.Equal(t, []string{"a", "b", "c"}, finished)
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, ErrPoolClosed, pool.Enqueue(context.Background(), testEvent("late"), handler.handle))
+}
+
+func TestWorkerPoolCloseCancelsOnDeadline(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+
+	handler := newBlockingHandler()
+	pool := NewWorkerPool(1, 10, 0, time.Minute)
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("running"), handler.handle))
+	<-handler.started
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("queued"), handler.handle))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := pool.Close(ctx)
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	finished, errs := handler.results()
+	assert.Equal(t, []string{"running"}, finished)
+	assert.True(t, errors.Is(errs[0], context.Canceled))
+
+	var dropped bool
+	for _, entry := range logs.Entries() {
+		if entry["msg"] == "dropped queued webhook event queued on shutdown" {
+			dropped = true
+		}
+	}
+	assert.True(t, dropped)
+}
+
+func TestWorkerPoolEventTimeout(t *testing.T) {
+	_, restore := logtest.Capture()
+	defer restore()
+
+	handler := newBlockingHandler()
+	pool := NewWorkerPool(1, 1, 0, 20*time.Millisecond)
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("slow"), handler.handle))
+	assert.NoError(t, pool.Close(context.Background()))
+
+	_, errs := handler.results()
+	if assert.Len(t, errs, 1) {
+		assert.True(t, errors.Is(errs[0], context.DeadlineExceeded))
+	}
+}
+
+func TestWorkerPoolRecoversPanics(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+
+	processed := false
+	pool := NewWorkerPool(1, 10, 0, time.Minute)
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("bad"), func(ctx context.Context, event *LokaliseEvent) error {
+		panic("boom")
+	}))
+	assert.NoError(t, pool.Enqueue(context.Background(), testEvent("good"), func(ctx context.Context, event *LokaliseEvent) error {
+		processed = true
+		return nil
+	}))
+	assert.NoError(t, pool.Close(context.Background()))
+
+	// The worker survives the panic and goes on with the next event.
+	assert.True(t, processed)
+	var panicked map[string]string
+	for _, entry := range logs.Entries() {
+		if entry["msg"] == `worker panicked processing webhook event bad: "boom"` {
+			panicked = entry
+		}
+	}
+	if assert.NotNil(t, panicked) {
+		assert.Equal(t, "error", panicked["level"])
+		assert.Contains(t, panicked["arg_stack"], "runtime/debug.Stack")
+	}
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -17,15 +21,18 @@ import (
 	"github.com/limitz404/lokalise-listener/logging"
 	"github.com/limitz404/lokalise-listener/lokalise"
 	"github.com/limitz404/lokalise-listener/utils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
-	httpAddress = ":https"
+	httpsAddress = ":https"
+	httpAddress  = ":http"
 )
 
 var (
-	certificatePath = os.Getenv("TLS_CERTIFICATE_PATH")
-	keyPath         = os.Getenv("TLS_PRIVATE_KEY_PATH")
+	// credentialHeaderRegexp matches the headers carrying secrets in the
+	// verbose request and response dumps.
+	credentialHeaderRegexp = regexp.MustCompile(`(?im)^(authorization|x-api-token|x-secret|x-secret-token):[^\r\n]*`)
 )
 
 func printRoutes(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
@@ -47,22 +54,153 @@ func printRoutes(route *mux.Route, router *mux.Router, ancestors []*mux.Route) e
 	return nil
 }
 
+// warmUp marks the server as ready once the Lokalise API token has been
+// validated, retrying until it is.
+func warmUp(readiness *utils.Readiness) {
+	for delay := time.Second; ; delay *= 2 {
+		err := lokalise.ValidateAPIToken(context.Background())
+		if err == nil {
+			readiness.SetReady(true)
+			return
+		}
+
+		if delay > time.Minute {
+			delay = time.Minute
+		}
+		logging.Warn().LogErrArgs("failed to validate Lokalise API token - retrying in {{.delay}}", err,
+			logging.Args{
+				"delay": logging.Duration(delay),
+			})
+		time.Sleep(delay)
+	}
+}
+
+// validate checks that the Lokalise API accepts the API token, and exits
+// non-zero if not, for deploy pipelines to catch bad secrets without
+// starting the server. The configuration, including the webhook secret, is
+// validated by LoadConfig before.
+func validate() {
+	ctx, cancel := context.WithTimeout(context.Background(), lokalise.APIRetryPolicy.Deadline)
+	defer cancel()
+
+	if err := lokalise.ValidateAPIToken(ctx); err != nil {
+		logging.Fatal().LogErr("configuration is invalid - the Lokalise API token was rejected", err)
+	}
+
+	logging.Info().Log("configuration is valid")
+	logging.Flush()
+}
+
 func main() {
+	config, configErr := LoadConfig()
 	verboseLogging := flag.Bool("verbose", false, "enable verbose logging")
+	healthzPath := flag.String("healthz-path", "/healthz", "path of the liveness probe endpoint")
+	metricsPath := flag.String("metrics-path", "/metrics", "path of the Prometheus metrics endpoint")
+	readyzPath := flag.String("readyz-path", "/readyz", "path of the readiness probe endpoint")
+	shutdownGracePeriod := flag.Duration("shutdown-grace-period", 15*time.Second, "time allowed for in-flight requests to finish on shutdown")
+	flag.IntVar(&lokalise.APIRetryPolicy.MaxAttempts, "lokalise-max-attempts", lokalise.APIRetryPolicy.MaxAttempts, "maximum number of attempts for each Lokalise API call")
+	flag.DurationVar(&lokalise.APIRetryPolicy.Deadline, "lokalise-retry-deadline", lokalise.APIRetryPolicy.Deadline, "total time allowed for each Lokalise API call, including retries")
+	flag.IntVar(&lokalise.RateLimitWarnThreshold, "lokalise-rate-limit-warn", lokalise.RateLimitWarnThreshold, "Lokalise API requests left in the rate limit window below which calls are logged at warn")
+	dedupSize := flag.Int("dedup-size", 1024, "number of processed webhook events remembered to ignore redeliveries, 0 to disable")
+	dedupTTL := flag.Duration("dedup-ttl", 10*time.Minute, "how long processed webhook events are remembered to ignore redeliveries")
+	workers := flag.Int("workers", 4, "number of goroutines processing webhook events, at least 1")
+	queueSize := flag.Int("queue-size", 100, "number of webhook events that can wait for a worker, at least 1")
+	queueFullWait := flag.Duration("queue-full-wait", time.Second, "how long a webhook waits for room in a full queue before a 503, 0 to respond straight away")
+	rateLimit := flag.Float64("rate-limit", 50, "webhook requests allowed per second overall, 0 to disable")
+	rateBurst := flag.Int("rate-burst", 100, "webhook requests allowed in a burst overall")
+	ipRateLimit := flag.Float64("ip-rate-limit", 5, "webhook requests allowed per second from each client IP, 0 to disable")
+	ipRateBurst := flag.Int("ip-rate-burst", 20, "webhook requests allowed in a burst from each client IP")
+	maxBodyBytes := flag.Int64("max-body-bytes", utils.DefaultMaxBodyBytes, "maximum size of request bodies, larger ones get a 413")
+	strictEvents := flag.Bool("strict-events", false, "reject webhook events with fields the listener doesn't know")
+	certFlag := flag.String("cert", config.TLSCertificatePath, "path of the TLS certificate, serving plain HTTP if neither it nor -key is set")
+	keyFlag := flag.String("key", config.TLSPrivateKeyPath, "path of the TLS private key")
+	slackWebhookURL := flag.String("slack-webhook-url", config.SlackWebhookURL, "Slack incoming webhook notified of webhook events, none if empty")
+	slackEvents := flag.String("slack-events", "project.translation.updated,project.imported", "comma-separated webhook events notified to Slack")
+	dryRun := flag.Bool("dry-run", config.DryRun, "log the actions webhook events would trigger instead of taking them")
+	eventTimeout := flag.Duration("event-timeout", 5*time.Minute, "time allowed for processing a queued webhook event")
+	queueDrainPeriod := flag.Duration("queue-drain-period", 15*time.Second, "time allowed for queued webhook events to finish on shutdown, on top of -shutdown-grace-period")
 	flag.Parse()
+	validating := flag.Arg(0) == "validate"
+	if validating {
+		// Failures should read as a log line and an exit status, not a panic.
+		logging.SetFatalBehavior(logging.FatalExit)
+	}
 	utils.VerboseLogging = *verboseLogging
+	logging.RegisterRedactedPattern(credentialHeaderRegexp)
+	logging.SetBuildInfo(logging.BuildInfo())
+
+	if configErr != nil {
+		logging.Fatal().LogErr("failed to load configuration", configErr)
+	}
+	// A pool without workers, or without room in its queue, would accept
+	// events that are never processed.
+	var flagProblems []string
+	if *workers < 1 {
+		flagProblems = append(flagProblems, "-workers must be at least 1, not "+strconv.Itoa(*workers))
+	}
+	if *queueSize < 1 {
+		flagProblems = append(flagProblems, "-queue-size must be at least 1, not "+strconv.Itoa(*queueSize))
+	}
+	if len(flagProblems) > 0 {
+		logging.Fatal().LogErr("failed to load configuration", errors.New("invalid flags: "+strings.Join(flagProblems, "; ")))
+	}
+	if err := logging.SetMinLevel(config.LogLevel); err != nil {
+		logging.Fatal().LogErr("failed to set the log level", err)
+	}
+	logging.SetEnv(config.Env)
+	logging.Info().LogArgs("loaded configuration", config.LogArgs())
+	lokalise.APIToken = config.LokaliseAPIToken
+	lokalise.WebhookSecrets = config.WebhookSecrets
+	lokalise.DryRun = *dryRun
+
+	if validating {
+		validate()
+		return
+	}
+
+	lokalise.Events.SetDeduplication(*dedupSize, *dedupTTL)
+	lokalise.Events.SetStrictDecoding(*strictEvents)
+	lokalise.Events.SetProjectFilter(config.ProjectAllowlist, config.ProjectDenylist)
+	if len(config.CaptureDir) > 0 {
+		store, err := lokalise.NewPayloadStore(config.CaptureDir, config.CaptureMaxCount, config.CaptureMaxBytes)
+		if err != nil {
+			logging.Fatal().LogErr("failed to open the webhook payload directory", err)
+		}
+		lokalise.Events.SetPayloadStore(store)
+	}
+	if len(*slackWebhookURL) > 0 {
+		notifier := lokalise.NewSlackNotifier(*slackWebhookURL)
+		for _, event := range utils.SplitList(*slackEvents) {
+			lokalise.Events.AddHandler(event, notifier.Notify)
+		}
+	}
+	workerPool := lokalise.NewWorkerPool(*workers, *queueSize, *queueFullWait, *eventTimeout)
+	lokalise.Events.SetWorkerPool(workerPool)
 
 	go braze.StartStringsCacheEvictionLoop()
 
+	readiness := &utils.Readiness{}
+	go warmUp(readiness)
+
 	router := mux.NewRouter()
+	router.HandleFunc(*healthzPath, utils.LivenessHandler).Methods(http.MethodGet)
+	router.Handle(*readyzPath, readiness).Methods(http.MethodGet)
+	router.Handle(*metricsPath, promhttp.Handler()).Methods(http.MethodGet)
 	router.Use(utils.AddUniqueRequestID)
+	router.Use(utils.LogRequestScope)
+	router.Use(utils.RecoverPanic)
+	// Rate limited webhooks are rejected before their bodies are read.
+	router.Use(utils.OnPathPrefix("/api/v1/lokalise", utils.NewRateLimiter(*rateLimit, *rateBurst, *ipRateLimit, *ipRateBurst).Middleware))
+	router.Use(utils.LimitRequestBody(*maxBodyBytes))
 	router.Use(utils.LogRequest)
 	static := router.PathPrefix("/static").Host("www.makeshift.dev")
 	staticServer := http.FileServer(utils.NeuteredFileSystem{FS: http.Dir("./static")})
 	static.Handler(http.StripPrefix("/static", staticServer)).Methods(http.MethodGet)
 
 	lokaliseAPI := router.PathPrefix("/api/v1/lokalise").Host("www.makeshift.dev").Subrouter()
-	lokaliseAPI.Handle("/order_complete", utils.ValidateAPIKey(http.HandlerFunc(lokalise.TaskCompletedHandler))).Methods(http.MethodPost)
+	lokaliseAPI.Handle("/replay", lokalise.ReplayHandler(lokalise.Events, config.AdminToken)).Methods(http.MethodPost)
+	lokaliseAPI.Handle("/recent", lokalise.RecentHandler(lokalise.RecentEvents, config.AdminToken)).Methods(http.MethodGet)
+	lokaliseAPI.Handle("/order_complete", utils.LogUnexpectedQuery()(utils.ValidateAPIKey(lokalise.VerifyLokaliseSignature(lokalise.WebhookSecrets, http.HandlerFunc(lokalise.TaskCompletedHandler))))).Methods(http.MethodPost)
 
 	brazeAPI := router.PathPrefix("/api/v1/braze").Host("www.makeshift.dev").Subrouter()
 	brazeAPI.HandleFunc("/parse_template", braze.ParseTemplateHandler).Methods(http.MethodPost)
@@ -77,8 +215,19 @@ func main() {
 
 	router.Walk(printRoutes)
 
+	address := httpsAddress
+	if config.Port != 0 {
+		address = ":" + strconv.Itoa(config.Port)
+	}
+
+	// baseCtx is the parent of the requests' contexts, cancelled to stop the
+	// events processed in requests if they outlast the grace period.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
-		Addr:         httpAddress,
+		Addr:         address,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
 		IdleTimeout:  time.Second * 60,
@@ -97,30 +246,75 @@ func main() {
 		},
 	}
 
-	logging.Info().LogArgs("listening for http/https: {{.address}}", logging.Args{"address": httpAddress})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serve := func() error { return srv.ListenAndServeTLS("", "") }
+	if len(*certFlag) == 0 && len(*keyFlag) == 0 {
+		srv.Addr = httpAddress
+		if config.Port != 0 {
+			srv.Addr = ":" + strconv.Itoa(config.Port)
+		}
+		serve = srv.ListenAndServe
+		logging.Warn().Log("no TLS certificate configured - serving plain HTTP")
+	} else {
+		reloader, err := utils.NewCertificateReloader(*certFlag, *keyFlag)
+		if err != nil {
+			logging.Fatal().LogErr("failed to load TLS certificate", err)
+		}
+		srv.TLSConfig.GetCertificate = reloader.GetCertificate
+	}
+
+	logging.Info().LogArgs("listening for http/https: {{.address}}", logging.Args{"address": srv.Addr})
 	go func() {
-		if err := srv.ListenAndServeTLS(certificatePath, keyPath); err != nil {
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			logging.Fatal().LogErr("failed to start http server", err)
 		}
 	}()
 
-	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
-	for {
-		sig := <-signalChannel
-		if sig == syscall.SIGHUP {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for waiting := true; waiting; {
+		select {
+		case <-hangups:
 			utils.VerboseLogging = !utils.VerboseLogging
 			logging.Info().LogArgs("verbose logging set to {{.value}}",
 				logging.Args{
 					"value": logging.Bool(utils.VerboseLogging),
 				})
-		} else {
-			break
+		case <-ctx.Done():
+			waiting = false
 		}
 	}
+	stop()
+	readiness.SetReady(false)
 
-	logging.Info().Log("Caught signal - handling graceful shutdown")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	logging.Info().LogArgs("caught signal - waiting up to {{.grace_period}} for in-flight requests",
+		logging.Args{
+			"grace_period": logging.Duration(*shutdownGracePeriod),
+		})
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownGracePeriod)
 	defer cancel()
-	srv.Shutdown(ctx)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		cancelRequests()
+		logging.Error().LogErr("failed to finish in-flight requests before shutting down - cancelled them", err)
+	} else {
+		logging.Info().Log("finished in-flight requests")
+	}
+
+	// The queue gets its own budget, starting once no request can add to it,
+	// rather than what is left of the requests' one.
+	logging.Info().LogArgs("waiting up to {{.drain_period}} for {{.depth}} queued events",
+		logging.Args{
+			"drain_period": logging.Duration(*queueDrainPeriod),
+			"depth":        logging.Int(workerPool.Depth()),
+		})
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), *queueDrainPeriod)
+	defer cancelDrain()
+	if err := workerPool.Close(drainCtx); err != nil {
+		logging.Error().LogErr("failed to finish queued events before shutting down - cancelled them", err)
+	} else {
+		logging.Info().Log("finished queued events - shutting down")
+	}
+	logging.Flush()
 }
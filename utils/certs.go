@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+)
+
+// certificateCheckInterval is the minimum time between the checks for a
+// changed certificate, so that handshakes don't all stat the files.
+const certificateCheckInterval = 10 * time.Second
+
+// CertificateReloader serves a TLS certificate loaded from disk, reloading it
+// when its files change so that rotating it doesn't need a restart.
+type CertificateReloader struct {
+	certPath string
+	keyPath  string
+
+	mutex    sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	checked  time.Time
+}
+
+// NewCertificateReloader loads the certificate and private key in the PEM
+// files at certPath and keyPath.
+func NewCertificateReloader(certPath, keyPath string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certPath: certPath, keyPath: keyPath}
+
+	modTimes, err := reloader.stat()
+	if err != nil {
+		return nil, WrapError(err)
+	}
+	if err := reloader.load(modTimes); err != nil {
+		return nil, WrapError(err)
+	}
+	reloader.checked = time.Now()
+
+	return reloader, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. If the files changed,
+// the certificate is reloaded. If that fails, the previous one is kept.
+func (reloader *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	if now := time.Now(); now.Sub(reloader.checked) >= certificateCheckInterval {
+		reloader.checked = now
+		reloader.reloadIfChanged()
+	}
+
+	return reloader.cert, nil
+}
+
+// reloadIfChanged reloads the certificate if the modification time of either
+// file changed. The mutex must be held.
+func (reloader *CertificateReloader) reloadIfChanged() {
+	args := logging.Args{
+		"cert_path": reloader.certPath,
+		"key_path":  reloader.keyPath,
+	}
+
+	modTimes, err := reloader.stat()
+	if err != nil {
+		logging.Error().LogErrArgs("failed to check TLS certificate {{.cert_path}} - keeping the current one", err, args)
+		return
+	}
+	if modTimes == reloader.modTimes {
+		return
+	}
+
+	if err := reloader.load(modTimes); err != nil {
+		logging.Error().LogErrArgs("failed to reload TLS certificate {{.cert_path}} - keeping the current one", err, args)
+		return
+	}
+	logging.Info().LogArgs("reloaded TLS certificate {{.cert_path}}", args)
+}
+
+// load replaces the certificate with the one in the files, recording their
+// modification times.
+func (reloader *CertificateReloader) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(reloader.certPath, reloader.keyPath)
+	if err != nil {
+		return WrapError(err)
+	}
+
+	reloader.cert = &cert
+	reloader.modTimes = modTimes
+	return nil
+}
+
+// stat returns the modification times of the certificate and key files.
+func (reloader *CertificateReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{reloader.certPath, reloader.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, WrapError(err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
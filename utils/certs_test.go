@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// selfSignedPair returns a new self-signed certificate for commonName and
+// its private key, PEM encoded, along with the certificate's DER bytes.
+func selfSignedPair(t *testing.T, commonName string) (certPEM, keyPEM, der []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, der
+}
+
+// writePair writes a certificate and key, with a modification time of
+// modTime so that the change is seen regardless of the file system's
+// timestamp resolution.
+func writePair(t *testing.T, certPath, keyPath string, certPEM, keyPEM []byte, modTime time.Time) {
+	t.Helper()
+
+	for path, data := range map[string][]byte{certPath: certPEM, keyPath: keyPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	firstCert, firstKey, firstDER := selfSignedPair(t, "first")
+	secondCert, secondKey, secondDER := selfSignedPair(t, "second")
+	writePair(t, certPath, keyPath, firstCert, firstKey, start)
+
+	reloader, err := NewCertificateReloader(certPath, keyPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	served := func() []byte {
+		cert, err := reloader.GetCertificate(nil)
+		assert.NoError(t, err)
+		return cert.Certificate[0]
+	}
+	// expireCheck makes the next handshake check the files again.
+	expireCheck := func() {
+		reloader.mutex.Lock()
+		reloader.checked = time.Now().Add(-certificateCheckInterval)
+		reloader.mutex.Unlock()
+	}
+	assert.Equal(t, firstDER, served())
+
+	// The files aren't checked again before the check interval.
+	writePair(t, certPath, keyPath, secondCert, secondKey, start.Add(time.Minute))
+	assert.Equal(t, firstDER, served())
+
+	expireCheck()
+	assert.Equal(t, secondDER, served())
+
+	// A broken pair, here the first certificate with the second key, keeps
+	// the current certificate.
+	writePair(t, certPath, keyPath, firstCert, secondKey, start.Add(2*time.Minute))
+	expireCheck()
+	assert.Equal(t, secondDER, served())
+
+	var failed bool
+	for _, entry := range logs.Entries() {
+		if entry["level"] == "error" && entry["msg"] == "failed to reload TLS certificate "+certPath+" - keeping the current one" {
+			failed = true
+		}
+	}
+	assert.True(t, failed)
+
+	// Once fixed, the pair is picked up.
+	writePair(t, certPath, keyPath, firstCert, firstKey, start.Add(3*time.Minute))
+	expireCheck()
+	assert.Equal(t, firstDER, served())
+}
+
+func TestNewCertificateReloaderFailsOnBrokenPair(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	certPEM, _, _ := selfSignedPair(t, "cert")
+	_, keyPEM, _ := selfSignedPair(t, "other")
+	writePair(t, certPath, keyPath, certPEM, keyPEM, time.Now())
+
+	_, err := NewCertificateReloader(certPath, keyPath)
+	assert.Error(t, err)
+
+	_, err = NewCertificateReloader(filepath.Join(dir, "missing.pem"), keyPath)
+	assert.Error(t, err)
+}
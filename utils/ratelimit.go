@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/limitz404/lokalise-listener/logging"
+)
+
+// idleBucketTimeout is how long a client's bucket is kept after its last
+// request. Buckets idle for longer are full again anyway.
+const idleBucketTimeout = 10 * time.Minute
+
+// tokenBucket allows rate requests per second with bursts of up to burst.
+type tokenBucket struct {
+	rate     float64
+	burst    float64
+	tokens   float64
+	refilled time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		refilled: now,
+	}
+}
+
+// wait refills the bucket for the time elapsed until now and returns how
+// long a request at now has to wait for a token, 0 if one is available.
+func (bucket *tokenBucket) wait(now time.Time) time.Duration {
+	bucket.tokens = math.Min(bucket.burst, bucket.tokens+now.Sub(bucket.refilled).Seconds()*bucket.rate)
+	bucket.refilled = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+	}
+	return 0
+}
+
+// RateLimiter limits the rate of requests, both overall and from each client
+// IP, with token buckets.
+type RateLimiter struct {
+	mutex sync.Mutex
+
+	global *tokenBucket
+
+	ipRate  float64
+	ipBurst int
+	clients map[string]*tokenBucket
+	swept   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing globalRate requests per second
+// overall, with bursts of up to globalBurst, and ipRate requests per second
+// from each client IP, with bursts of up to ipBurst. A rate of 0 or less
+// disables the corresponding limit.
+func NewRateLimiter(globalRate float64, globalBurst int, ipRate float64, ipBurst int) *RateLimiter {
+	limiter := &RateLimiter{
+		ipRate:  ipRate,
+		ipBurst: ipBurst,
+		clients: map[string]*tokenBucket{},
+		swept:   time.Now(),
+	}
+	if globalRate > 0 {
+		limiter.global = newTokenBucket(globalRate, globalBurst, time.Now())
+	}
+	return limiter
+}
+
+// allow reports whether a request from ip at now is within both limits and,
+// if not, how long the client should wait before retrying. A token is only
+// taken from either bucket if both have one, so that rejected requests don't
+// use up a budget.
+func (limiter *RateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	var buckets []*tokenBucket
+	if limiter.ipRate > 0 {
+		if now.Sub(limiter.swept) > idleBucketTimeout {
+			for client, bucket := range limiter.clients {
+				if now.Sub(bucket.refilled) > idleBucketTimeout {
+					delete(limiter.clients, client)
+				}
+			}
+			limiter.swept = now
+		}
+
+		bucket, ok := limiter.clients[ip]
+		if !ok {
+			bucket = newTokenBucket(limiter.ipRate, limiter.ipBurst, now)
+			limiter.clients[ip] = bucket
+		}
+		buckets = append(buckets, bucket)
+	}
+	if limiter.global != nil {
+		buckets = append(buckets, limiter.global)
+	}
+
+	var wait time.Duration
+	for _, bucket := range buckets {
+		if bucketWait := bucket.wait(now); bucketWait > wait {
+			wait = bucketWait
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true, 0
+}
+
+// Middleware responds to the requests exceeding the limits with a 429 and a
+// Retry-After header instead of passing them on to next.
+func (limiter *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ip := clientIP(request)
+		ok, wait := limiter.allow(ip, time.Now())
+		if !ok {
+			retryAfter := retryAfterSeconds(wait)
+
+			writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			logging.Warn().WithContext(request.Context()).LogArgs("rejected request from {{.client_ip}} exceeding the rate limit",
+				logging.Args{
+					"client_ip":   ip,
+					"retry_after": logging.Int(retryAfter),
+				})
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// retryAfterSeconds rounds wait up to the whole seconds of a Retry-After
+// header, at least 1.
+func retryAfterSeconds(wait time.Duration) int {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	return retryAfter
+}
+
+// OnPathPrefix returns a middleware applying middleware to the requests whose
+// path starts with prefix, and passing the others straight to next, e.g. to
+// rate limit some routes before the middlewares shared by every route.
+func OnPathPrefix(prefix string, middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := middleware(next)
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if strings.HasPrefix(request.URL.Path, prefix) {
+				wrapped.ServeHTTP(writer, request)
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// clientIP returns the IP address of the client that sent request.
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		ip      string
+		after   time.Duration
+		allowed bool
+		wait    time.Duration
+	}
+	for _, test := range []struct {
+		name                 string
+		globalRate, ipRate   float64
+		globalBurst, ipBurst int
+		steps                []step
+	}{
+		{
+			name:   "per-IP burst then refill",
+			ipRate: 1, ipBurst: 2,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"a", 0, true, 0},
+				{"a", 0, false, time.Second},
+				{"b", 0, true, 0},
+				{"a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+				{"a", time.Second, true, 0},
+			},
+		},
+		{
+			name:       "global limit shared by IPs",
+			globalRate: 2, globalBurst: 2,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"b", 0, true, 0},
+				{"c", 0, false, 500 * time.Millisecond},
+				{"c", 500 * time.Millisecond, true, 0},
+			},
+		},
+		{
+			// The requests rejected by the global limit leave the client's
+			// own budget intact.
+			name:       "global rejection keeps IP tokens",
+			globalRate: 1, globalBurst: 1,
+			ipRate: 1, ipBurst: 2,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"b", 0, false, time.Second},
+				{"b", 0, false, time.Second},
+				{"b", time.Second, true, 0},
+				{"b", 2 * time.Second, true, 0},
+			},
+		},
+		{
+			name:       "IP rejection keeps global tokens",
+			globalRate: 1, globalBurst: 2,
+			ipRate: 1, ipBurst: 1,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"a", 0, false, time.Second},
+				{"b", 0, true, 0},
+			},
+		},
+		{
+			name: "disabled",
+			steps: []step{
+				{"a", 0, true, 0},
+				{"a", 0, true, 0},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(test.globalRate, test.globalBurst, test.ipRate, test.ipBurst)
+			if limiter.global != nil {
+				limiter.global.refilled = start
+			}
+			limiter.swept = start
+
+			for i, step := range test.steps {
+				allowed, wait := limiter.allow(step.ip, start.Add(step.after))
+				assert.Equal(t, step.allowed, allowed, "step %d", i)
+				assert.Equal(t, step.wait, wait, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestRateLimiterSweepsIdleClients(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(0, 0, 1, 1)
+	limiter.swept = start
+
+	limiter.allow("a", start)
+	limiter.allow("b", start.Add(idleBucketTimeout))
+	assert.Len(t, limiter.clients, 2)
+
+	limiter.allow("b", start.Add(idleBucketTimeout+time.Second))
+	assert.Len(t, limiter.clients, 1)
+	assert.Contains(t, limiter.clients, "b")
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	for wait, expected := range map[time.Duration]int{
+		0:                       1,
+		time.Millisecond:        1,
+		time.Second:             1,
+		1001 * time.Millisecond: 2,
+		2500 * time.Millisecond: 3,
+	} {
+		assert.Equal(t, expected, retryAfterSeconds(wait), wait.String())
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limiter := NewRateLimiter(0, 0, 0.5, 1)
+	handler := limiter.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/lokalise/order_complete", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+}
+
+func TestOnPathPrefix(t *testing.T) {
+	var applied []string
+	middleware := OnPathPrefix("/api/v1/lokalise", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			applied = append(applied, request.URL.Path)
+			next.ServeHTTP(writer, request)
+		})
+	})
+	handler := middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+
+	for _, path := range []string{"/api/v1/lokalise/order_complete", "/api/v1/braze/strings", "/healthz"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, []string{"/api/v1/lokalise/order_complete"}, applied)
+}
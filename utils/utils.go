@@ -2,9 +2,11 @@ package utils
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -13,8 +15,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	crand "crypto/rand"
@@ -151,6 +156,197 @@ func AddUniqueRequestID(next http.Handler) http.Handler {
 	})
 }
 
+// LogRequestScope binds the request ID, method, path and remote address to
+// the request's context, so that loggers created with logging.FromContext or
+// WithContext add them to every line, and writes one access line per request
+// with the status and the latency in milliseconds. The request ID set by
+// AddUniqueRequestID is used when present, and one is generated and echoed
+// in the response headers otherwise.
+func LogRequestScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		requestID := request.Header.Get(UniqueRequestIDHeaderKey)
+		if len(requestID) == 0 {
+			requestID = strconv.FormatUint(rand.Uint64(), 36)
+			request.Header.Set(UniqueRequestIDHeaderKey, requestID)
+			writer.Header().Set(UniqueRequestIDHeaderKey, requestID)
+		}
+
+		ctx := logging.ContextWithFields(request.Context(), logging.Args{
+			"request_id":  requestID,
+			"method":      request.Method,
+			"path":        request.URL.Path,
+			"remote_addr": request.RemoteAddr,
+		})
+		request = request.WithContext(ctx)
+
+		statusRW := &loggingResponseWriter{ResponseWriter: writer}
+		next.ServeHTTP(statusRW, request)
+
+		status := statusRW.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		logging.FromContext(ctx).LogArgs("{{.method}} {{.path}} {{.status}}", logging.Args{
+			"status":     logging.Int(status),
+			"latency_ms": logging.DurationMillis(time.Since(start)),
+		})
+	})
+}
+
+// RecoverPanic responds with a 500 when next panics, logging the panic with
+// its stack, so that a single bad request doesn't take the listener down.
+// http.ErrAbortHandler is passed on, since it is meant to abort the response.
+func RecoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			logging.Error().WithContext(request.Context()).LogArgs("recovered from panic serving request: {{.panic}}",
+				logging.Args{
+					"panic": logging.Str(r),
+					"stack": string(debug.Stack()),
+				})
+		}()
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// DefaultMaxBodyBytes is the default limit of LimitRequestBody.
+const DefaultMaxBodyBytes = 4 << 20
+
+// LimitRequestBody returns a middleware reading request bodies up to limit
+// bytes before passing requests on, so that later handlers only ever decode
+// bodies within the limit. Requests with larger bodies get a 413. Bodies with
+// a gzip Content-Encoding are decompressed, the limit applying to both the
+// compressed and the decompressed body so that a small body can't expand
+// without bound, and malformed ones get a 400. Bodies with any other
+// Content-Encoding get a 415, rather than being passed on still encoded.
+func LimitRequestBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.Body == nil || request.Body == http.NoBody {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			switch encoding := strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding"))); encoding {
+			case "", "identity", "gzip":
+			default:
+				http.Error(writer, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+				logging.Error().WithContext(request.Context()).LogArgs("rejected request body with unsupported content encoding {{.content_encoding}}",
+					logging.Args{
+						"content_encoding": encoding,
+					})
+				return
+			}
+
+			body, gzipped, err := readRequestBody(writer, request, limit)
+			request.Body.Close()
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					logging.Error().WithContext(request.Context()).LogErrArgs("rejected request body larger than {{.limit}} bytes", err,
+						logging.Args{
+							"limit": logging.Int64(limit),
+						})
+					return
+				}
+
+				http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				if gzipped {
+					logging.Error().WithContext(request.Context()).LogErr("rejected malformed gzip request body", err)
+				} else {
+					logging.Error().WithContext(request.Context()).LogErr("failed to read request body", err)
+				}
+				return
+			}
+
+			if gzipped {
+				// Later handlers see the decompressed body as if it had been
+				// sent as is.
+				request.Header.Del("Content-Encoding")
+				request.Header.Del("Content-Length")
+				request.ContentLength = int64(len(body))
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// readRequestBody reads up to limit bytes of the body of request, and up to
+// limit bytes of its decompressed content if it is gzipped, reporting
+// whether it was. Larger bodies fail with an *http.MaxBytesError.
+func readRequestBody(writer http.ResponseWriter, request *http.Request, limit int64) ([]byte, bool, error) {
+	body := http.MaxBytesReader(writer, request.Body, limit)
+	if !strings.EqualFold(strings.TrimSpace(request.Header.Get("Content-Encoding")), "gzip") {
+		data, err := ioutil.ReadAll(body)
+		return data, false, err
+	}
+
+	reader, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, true, WrapError(err)
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, true, WrapError(err)
+	}
+	if int64(len(data)) > limit {
+		return nil, true, WrapError(&http.MaxBytesError{Limit: limit})
+	}
+
+	logging.Debug().WithContext(request.Context()).LogArgs("decompressed gzip request body of {{.size}} bytes",
+		logging.Args{
+			"size": logging.Int(len(data)),
+		})
+	return data, true, nil
+}
+
+// LogUnexpectedQuery returns a middleware logging at debug the names of the
+// query parameters of requests other than allowed, e.g. to notice a
+// misconfigured webhook URL. Requests are passed on unchanged either way.
+func LogUnexpectedQuery(allowed ...string) func(http.Handler) http.Handler {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allowedSet[name] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			var unexpected []string
+			for name := range request.URL.Query() {
+				if !allowedSet[name] {
+					unexpected = append(unexpected, name)
+				}
+			}
+
+			if len(unexpected) > 0 {
+				sort.Strings(unexpected)
+				logging.Debug().WithContext(request.Context()).LogArgs("request has unexpected query parameters {{.params}}",
+					logging.Args{
+						"params": strings.Join(unexpected, ","),
+					})
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
 // LogRequest wraps an HTTP handler by logging the request then serving the request.
 func LogRequest(next http.Handler) http.Handler {
 	combinedLoggingWriter := CombinedLoggingWriter{startTime: time.Now()}
@@ -375,6 +571,9 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) error
 }
 
 // WrapError adds stack information to an error so its origin can be easily deduced.
+// The error is wrapped rather than flattened into the message, so callers
+// can still match it with errors.Is and errors.As, e.g. to tell a
+// cancellation or an *http.MaxBytesError from other failures.
 func WrapError(err error) error {
 	if err == nil {
 		return nil
@@ -391,9 +590,20 @@ func WrapError(err error) error {
 	errorString.WriteString(line)
 	errorString.WriteRune(')')
 	errorString.WriteString("->")
-	errorString.WriteString(err.Error())
 
-	return errors.New(errorString.String())
+	return fmt.Errorf("%s%w", errorString.String(), err)
+}
+
+// SplitList returns the non-empty items of a comma-separated list, with the
+// surrounding spaces trimmed.
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // FlattenPostForm converts from a struct of lists to a map[string]string
@@ -420,3 +630,42 @@ func FlattenPostForm(form url.Values) (map[string]string, error) {
 
 	return stringMap, nil
 }
+
+// LivenessHandler responds with a 200 to show that the server is up.
+func LivenessHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.WriteHeader(http.StatusOK)
+	writer.Write([]byte("ok"))
+}
+
+// Readiness responds with a 503 until the server is ready to handle
+// requests, and with a 200 after.
+type Readiness struct {
+	ready int32
+}
+
+// SetReady marks the server as ready or not, logging the transition.
+func (readiness *Readiness) SetReady(ready bool) {
+	var value int32
+	if ready {
+		value = 1
+	}
+
+	if atomic.SwapInt32(&readiness.ready, value) != value {
+		logging.Info().LogArgs("readiness set to {{.ready}}", logging.Args{"ready": logging.Bool(ready)})
+	}
+}
+
+// IsReady reports whether the server is ready.
+func (readiness *Readiness) IsReady() bool {
+	return atomic.LoadInt32(&readiness.ready) == 1
+}
+
+func (readiness *Readiness) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if !readiness.IsReady() {
+		http.Error(writer, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	writer.Write([]byte("ok"))
+}
@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/limitz404/lokalise-listener/logging"
+	"github.com/limitz404/lokalise-listener/logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapError(t *testing.T) {
+	assert.NoError(t, WrapError(nil))
+
+	err := WrapError(WrapError(context.Canceled))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, strings.HasPrefix(err.Error(), "(utils_test.go, TestWrapError(), "))
+	assert.True(t, strings.HasSuffix(err.Error(), "->context canceled"))
+
+	err = WrapError(fmt.Errorf("reading body: %w", &http.MaxBytesError{Limit: 10}))
+	var maxBytesErr *http.MaxBytesError
+	if assert.True(t, errors.As(err, &maxBytesErr)) {
+		assert.Equal(t, int64(10), maxBytesErr.Limit)
+	}
+
+	assert.False(t, errors.Is(WrapError(errors.New("context canceled")), context.Canceled))
+}
+
+// gzipped returns data compressed with gzip.
+func gzipped(data []byte) []byte {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(data)
+	writer.Close()
+	return compressed.Bytes()
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		body     []byte
+		encoding string
+		status   int
+		logged   string
+	}{
+		{name: "plain", body: []byte(`{"event":"x"}`), status: http.StatusOK},
+		{name: "identity", body: []byte(`{"event":"x"}`), encoding: "identity", status: http.StatusOK},
+		{name: "gzip", body: gzipped([]byte(`{"event":"x"}`)), encoding: "gzip", status: http.StatusOK, logged: "decompressed gzip request body of 13 bytes"},
+		{name: "gzip in upper case", body: gzipped([]byte(`{"event":"x"}`)), encoding: " GZIP ", status: http.StatusOK},
+		{name: "unknown encoding", body: []byte(`{"event":"x"}`), encoding: "br", status: http.StatusUnsupportedMediaType, logged: "rejected request body with unsupported content encoding br"},
+		{name: "too large", body: make([]byte, 65), status: http.StatusRequestEntityTooLarge, logged: "rejected request body larger than 64 bytes"},
+		{name: "decompressed too large", body: gzipped(make([]byte, 65)), encoding: "gzip", status: http.StatusRequestEntityTooLarge, logged: "rejected request body larger than 64 bytes"},
+		{name: "malformed gzip", body: []byte(`{"event":"x"}`), encoding: "gzip", status: http.StatusBadRequest, logged: "rejected malformed gzip request body"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			logs, restore := logtest.Capture()
+			defer restore()
+			var received []byte
+			handler := LimitRequestBody(64)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				received, _ = io.ReadAll(request.Body)
+				if strings.EqualFold(strings.TrimSpace(test.encoding), "gzip") {
+					// The body is passed on decompressed.
+					assert.Empty(t, request.Header.Get("Content-Encoding"))
+				}
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/lokalise/order_complete", bytes.NewReader(test.body))
+			if len(test.encoding) > 0 {
+				request.Header.Set("Content-Encoding", test.encoding)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, test.status, recorder.Code)
+			if test.status == http.StatusOK {
+				assert.Equal(t, `{"event":"x"}`, string(received))
+			} else {
+				assert.Nil(t, received)
+			}
+			if len(test.logged) > 0 {
+				assert.True(t, hasLogLine(logs, test.logged), test.logged)
+			}
+		})
+	}
+}
+
+// hasLogLine reports whether a line with msg was logged to logs.
+func hasLogLine(logs *logtest.Buffer, msg string) bool {
+	for _, entry := range logs.Entries() {
+		if entry["msg"] == msg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRecoverPanic(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+	handler := RecoverPanic(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		panic("boom")
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/lokalise/order_complete", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	var panicked map[string]string
+	for _, entry := range logs.Entries() {
+		if entry["msg"] == `recovered from panic serving request: "boom"` {
+			panicked = entry
+		}
+	}
+	if assert.NotNil(t, panicked) {
+		assert.Equal(t, "error", panicked["level"])
+		assert.Contains(t, panicked["arg_stack"], "runtime/debug.Stack")
+	}
+
+	// Aborting the response is left to net/http.
+	abort := RecoverPanic(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestLogRequestScope(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+	handler := LogRequestScope(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		logging.Info().WithContext(request.Context()).Log("handling request")
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/lokalise/order_complete", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	requestID := recorder.Header().Get(UniqueRequestIDHeaderKey)
+	assert.NotEmpty(t, requestID)
+	entries := logs.Entries()
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	// Lines logged while handling the request carry its scope.
+	for _, entry := range entries {
+		assert.Equal(t, requestID, entry["arg_request_id"])
+		assert.Equal(t, "POST", entry["arg_method"])
+		assert.Equal(t, "/api/v1/lokalise/order_complete", entry["arg_path"])
+		assert.Equal(t, "192.0.2.1:1234", entry["arg_remote_addr"])
+	}
+	assert.Equal(t, "handling request", entries[0]["msg"])
+	access := entries[1]
+	assert.Equal(t, "POST /api/v1/lokalise/order_complete 202", access["msg"])
+	assert.Equal(t, "202", access["arg_status"])
+	_, err := strconv.ParseFloat(access["arg_latency_ms"], 64)
+	assert.NoError(t, err, access["arg_latency_ms"])
+
+	// A request ID set earlier is kept, and an implicit 200 is logged as one.
+	handler = LogRequestScope(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	request = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	request.Header.Set(UniqueRequestIDHeaderKey, "req-1")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Empty(t, recorder.Header().Get(UniqueRequestIDHeaderKey))
+	entries = logs.Entries()
+	access = entries[len(entries)-1]
+	assert.Equal(t, "req-1", access["arg_request_id"])
+	assert.Equal(t, "200", access["arg_status"])
+}
+
+func TestLogRequest(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+	handler := LogRequest(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/lokalise/order_complete", nil)
+	request.Header.Set(UniqueRequestIDHeaderKey, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	entries := logs.Entries()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "trace", entries[0]["level"])
+		assert.Contains(t, entries[0]["msg"], `"POST /api/v1/lokalise/order_complete HTTP/1.1" 202`)
+		assert.Contains(t, entries[0]["msg"], " req-1 ")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+	readiness := &Readiness{}
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		readiness.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return recorder
+	}
+
+	response := get()
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.Equal(t, "not ready\n", response.Body.String())
+	assert.False(t, readiness.IsReady())
+
+	readiness.SetReady(true)
+	// Setting it again isn't a transition.
+	readiness.SetReady(true)
+	response = get()
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "ok", response.Body.String())
+
+	readiness.SetReady(false)
+	assert.Equal(t, http.StatusServiceUnavailable, get().Code)
+
+	var transitions []string
+	for _, entry := range logs.Entries() {
+		if entry["msgTemplate"] == "readiness set to {{.ready}}" {
+			assert.Equal(t, "info", entry["level"])
+			transitions = append(transitions, entry["arg_ready"])
+		}
+	}
+	assert.Equal(t, []string{"true", "false"}, transitions)
+}
+
+func TestLogUnexpectedQuery(t *testing.T) {
+	logs, restore := logtest.Capture()
+	defer restore()
+	passed := 0
+	handler := LogUnexpectedQuery("id")(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		passed++
+	}))
+
+	// Expected parameters, or none, log nothing.
+	for _, target := range []string{"/api/v1/lokalise/order_complete", "/api/v1/lokalise/replay?id=1"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+	}
+	assert.Empty(t, logs.Entries())
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/lokalise/order_complete?utm_source=x&id=1&debug", nil))
+
+	// The request is passed on all the same.
+	assert.Equal(t, 3, passed)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	entries := logs.Entries()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "debug", entries[0]["level"])
+		assert.Equal(t, "request has unexpected query parameters debug,utm_source", entries[0]["msg"])
+	}
+}